@@ -0,0 +1,133 @@
+package wsrest
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Principal is identity of authenticated peer attached to Conn
+type Principal struct {
+	ID     string                 `json:"id"`
+	Roles  []string               `json:"roles,omitempty"`
+	Scopes []string               `json:"scopes,omitempty"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator is called before websocket upgrade or before routing on REST.
+// Returning error rejects connection. Use AuthError to control status code, otherwise 401 is used.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+type AuthError struct {
+	Code    int
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+var (
+	ErrUnauthorized = &AuthError{Code: http.StatusUnauthorized, Message: "Unauthorized"}
+	ErrForbidden    = &AuthError{Code: http.StatusForbidden, Message: "Forbidden"}
+)
+
+// TokenValidator validates token and returns its identity
+type TokenValidator func(token string) (*Principal, error)
+
+// TokenAuthenticator looks for token in Authorization Bearer header, then in query and at last in cookie.
+type TokenAuthenticator struct {
+	Query    string
+	Cookie   string
+	Validate TokenValidator
+}
+
+func NewTokenAuthenticator(validate TokenValidator) *TokenAuthenticator {
+	return &TokenAuthenticator{
+		Query:    "access_token",
+		Cookie:   "access_token",
+		Validate: validate,
+	}
+}
+
+func (a *TokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := a.token(r)
+	if token == "" {
+		return nil, ErrUnauthorized
+	}
+	return a.Validate(token)
+}
+
+func (a *TokenAuthenticator) token(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+			return strings.TrimSpace(h[7:])
+		}
+	}
+
+	if a.Query != "" {
+		if t := r.URL.Query().Get(a.Query); t != "" {
+			return t
+		}
+	}
+
+	if a.Cookie != "" {
+		if c, err := r.Cookie(a.Cookie); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// authenticate runs authenticator and writes rejection in case of failure
+func authenticate(w http.ResponseWriter, r *http.Request, a Authenticator) (*Principal, bool) {
+	if a == nil {
+		return nil, true
+	}
+
+	p, err := authenticatePrincipal(r, a)
+	if err != nil {
+		code := http.StatusUnauthorized
+		if aerr, ok := err.(*AuthError); ok {
+			code = aerr.Code
+		}
+		writeHTTPError(w, code, SimpleMsg(err.Error()))
+		return nil, false
+	}
+
+	return p, true
+}
+
+// authenticatePrincipal calls authenticator. Missing principal is ErrUnauthorized
+func authenticatePrincipal(r *http.Request, a Authenticator) (*Principal, error) {
+	p, err := a.Authenticate(r)
+	if err == nil && p == nil {
+		err = ErrUnauthorized
+	}
+	return p, err
+}
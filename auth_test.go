@@ -0,0 +1,163 @@
+package wsrest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAuthServer(t *testing.T) *httptest.Server {
+	router := NewRouter()
+	router.HandleFunc("/whoami", func(c *Conn, m *Request) {
+		p, ok := c.Principal()
+		if !ok {
+			c.Respond(m, SimpleMsg("anonymous"), http.StatusOK)
+			return
+		}
+		c.Respond(m, SimpleMsg(p.ID), http.StatusOK)
+	})
+
+	h := NewHandler(router)
+	h.Authenticator = NewTokenAuthenticator(func(token string) (*Principal, error) {
+		switch token {
+		case "secret":
+			return &Principal{ID: "john"}, nil
+		case "banned":
+			return nil, ErrForbidden
+		}
+		return nil, ErrUnauthorized
+	})
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAuthRest(t *testing.T) {
+	server := testAuthServer(t)
+
+	testcases := []struct {
+		header string
+		code   int
+		body   string
+	}{
+		{header: "", code: http.StatusUnauthorized, body: `{"message":"Unauthorized"}`},
+		{header: "Bearer wrong", code: http.StatusUnauthorized, body: `{"message":"Unauthorized"}`},
+		{header: "Bearer banned", code: http.StatusForbidden, body: `{"message":"Forbidden"}`},
+		{header: "Bearer secret", code: http.StatusOK, body: `{"message":"john"}`},
+	}
+
+	for _, tc := range testcases {
+		req, err := http.NewRequest("GET", server.URL+"/whoami", nil)
+		require.Nil(t, err)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(t, err)
+
+		assert.Equal(t, tc.code, resp.StatusCode)
+		assert.Equal(t, tc.body, string(body))
+	}
+}
+
+func TestAuthWebsocket(t *testing.T) {
+	server := testAuthServer(t)
+	domain := strings.Replace(server.URL, "http", "ws", 1)
+
+	_, resp, err := websocket.DefaultDialer.Dial(domain+"/ws", nil)
+	require.NotNil(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	client, err := Dial(domain+"/ws?access_token=secret", nil)
+	require.Nil(t, err)
+	defer client.Close()
+
+	res, err := client.Get("/whoami", nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `{"message":"john"}`, string(res.GetData()))
+}
+
+func TestRouteAuthorization(t *testing.T) {
+	router := NewRouter()
+	ok := func(c *Conn, m *Request) { c.Respond(m, SimpleMsg("ok"), http.StatusOK) }
+	router.HandleFunc("/admin/users", ok).Method("DELETE").Require("admin")
+	router.HandleFunc("/reports", ok).RequireScope("reports:read")
+	router.HandleFunc("/own", ok).Policy(func(p *Principal, method, path string, params map[string]string) error {
+		if p == nil || params["user"] != p.ID {
+			return ErrForbidden
+		}
+		return nil
+	})
+
+	var denied int32
+	router.OnAccessDenied(func(c *Conn, m *Request, err error) { atomic.AddInt32(&denied, 1) })
+
+	h := NewHandler(router)
+	h.Authenticator = AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		switch r.Header.Get("Authorization") {
+		case "admin":
+			return &Principal{ID: "root", Roles: []string{"admin"}}, nil
+		case "user":
+			return &Principal{ID: "john", Scopes: []string{"reports:read"}}, nil
+		}
+		return nil, ErrUnauthorized
+	})
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	testcases := []struct {
+		method   string
+		resource string
+		user     string
+		code     int
+	}{
+		{method: "DELETE", resource: "/admin/users", user: "admin", code: http.StatusOK},
+		{method: "DELETE", resource: "/admin/users", user: "user", code: http.StatusForbidden},
+		{method: "GET", resource: "/reports", user: "user", code: http.StatusOK},
+		{method: "GET", resource: "/reports", user: "admin", code: http.StatusForbidden},
+		{method: "GET", resource: "/own?user=john", user: "user", code: http.StatusOK},
+		{method: "GET", resource: "/own?user=root", user: "user", code: http.StatusForbidden},
+	}
+
+	for _, tc := range testcases {
+		req, err := http.NewRequest(tc.method, server.URL+tc.resource, nil)
+		require.Nil(t, err)
+		req.Header.Set("Authorization", tc.user)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, tc.code, resp.StatusCode, "%s %s as %s", tc.method, tc.resource, tc.user)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&denied))
+
+	//Same rules apply over websocket
+	domain := strings.Replace(server.URL, "http", "ws", 1)
+	conn, _, err := websocket.DefaultDialer.Dial(domain, http.Header{"Authorization": []string{"user"}})
+	require.Nil(t, err)
+	defer conn.Close()
+
+	m, err := NewRequest("DELETE", "/admin/users", nil)
+	require.Nil(t, err)
+	require.Nil(t, conn.WriteJSON(m))
+
+	res := &Request{}
+	require.Nil(t, conn.ReadJSON(res))
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&denied))
+}
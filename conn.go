@@ -4,16 +4,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"runtime/debug"
 	"sync"
 	"time"
 	"wsrest/datastream"
+	"wsrest/logger"
+	"wsrest/tracing"
 
 	"github.com/gorilla/websocket"
-	"github.com/sirupsen/logrus"
+	uuid "github.com/satori/go.uuid"
 )
 
 type ConnCloseHandlerFn func(wsc *Conn)
 
+// PanicHandlerFn is called after handler panic is recovered, with recovered value and stack trace
+type PanicHandlerFn func(wsc *Conn, m *Request, v interface{}, stack []byte)
+
+// Upgrader is used by NewConnWS. Use Handler UpgradeOptions or NewConnWSUpgrader for per endpoint settings
 var Upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
@@ -34,18 +41,36 @@ const (
 
 type Conn struct {
 	mutex          sync.RWMutex
-	C              *websocket.Conn
-	W              http.ResponseWriter
-	R              *http.Request
+	ID             string
+	T              Transport
+	R              *http.Request //Http request connection is created from, if any
 	SendCh         chan []byte
 	StopCh         chan bool
+	closeCh        chan CloseInfo
+	writeDone      chan struct{} //Closed when write pump exits
 	Router         Router
 	Vars           map[string]interface{}
 	Closed         bool
 	MaxMessageSize int64
-	Log            logrus.StdLogger
+	Log            logger.Logger
+	logMutex       sync.RWMutex
+	baseLog        logger.Logger
+	fieldLog       logger.Logger //baseLog with connection fields, read through Log
 	CloseHandlers  []ConnCloseHandlerFn
+	PanicHandler   PanicHandlerFn
 	marshaler      datastream.Marshaler
+	principal      *Principal
+	limits         connLimits
+	dispatchMode   DispatchMode
+	dispatchKey    DispatchKeyFn
+	queue          keyedQueue
+	state          int32
+	hooks          connHooks
+	closeInfo      *CloseInfo
+	opened         bool
+	session        *Session
+	sessionBuffer  int
+	replay         [][]byte
 }
 
 func (wsc *Conn) Lock() {
@@ -72,86 +97,232 @@ func (wsc *Conn) IsClosed() bool {
 
 func constructConn() *Conn {
 	wsc := &Conn{
-		C:              nil, //Websocket connecting
-		W:              nil, //Http writter
+		ID:             uuid.NewV4().String(),
+		T:              nil,
 		R:              nil, //Http request
 		SendCh:         make(chan []byte),
 		StopCh:         make(chan bool),
+		closeCh:        make(chan CloseInfo),
+		writeDone:      make(chan struct{}),
 		Vars:           make(map[string]interface{}),
 		MaxMessageSize: 102400,
 		Router:         NewRouter(),
 		marshaler:      &datastream.JSONMarshaler{},
 	}
+	wsc.Log = connLogger{wsc}
+	wsc.queue.max = DispatchQueueSize
 
 	return wsc
 }
 
-func NewConnWS(w http.ResponseWriter, r *http.Request, router Router) (*Conn, error) {
+// NewConn creates connection on transport. Connection is served with Serve
+func NewConn(t Transport, router Router) *Conn {
 	wsc := constructConn()
-	u, err := Upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		return nil, err
+	wsc.T = t
+	if rt, ok := t.(ResponseTransport); ok {
+		wsc.R = rt.Request()
 	}
-
-	wsc.C = u
 	wsc.Router = router
+	wsc.SetLogger(logger.Default())
 
-	wsc.Log = logrus.New().WithFields(logrus.Fields{
-		"conn": fmt.Sprintf("WSCONN[%s]", wsc.GetRemoteAddr()),
-	})
+	return wsc
+}
 
-	return wsc, nil
+func NewConnWS(w http.ResponseWriter, r *http.Request, router Router) (*Conn, error) {
+	return NewConnWSUpgrader(w, r, router, &Upgrader, nil)
 }
 
-func NewConnRest(w http.ResponseWriter, r *http.Request, router Router) (*Conn, error) {
-	wsc := constructConn()
-	wsc.W = w
+// NewConnWSUpgrader is same as NewConnWS, but upgrades with custom upgrader and response header
+func NewConnWSUpgrader(w http.ResponseWriter, r *http.Request, router Router, upgrader *websocket.Upgrader, header http.Header) (*Conn, error) {
+	u, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	wsc := NewConn(NewWSTransport(u), router)
 	wsc.R = r
-	wsc.Router = router
+	return wsc, nil
+}
 
-	wsc.Log = logrus.New().WithFields(logrus.Fields{
-		"conn": fmt.Sprintf("RESTCONN[%s]", wsc.GetRemoteAddr()),
-	})
+func NewConnRest(w http.ResponseWriter, r *http.Request, router Router) (*Conn, error) {
+	return NewConn(NewHTTPTransport(w, r), router), nil
+}
 
-	return wsc, nil
+// Serve handles connection until it is closed. Request response transport is served with single request
+func (wsc *Conn) Serve() {
+	if _, ok := wsc.T.(ResponseTransport); ok {
+		wsc.HandleRestConnection()
+		return
+	}
+	wsc.HandleWSConnection()
 }
 
+// HandleWSConnection serves streaming transport, reading requests and writing responses in own go routines
 func (wsc *Conn) HandleWSConnection() {
+	wsc.open()
 	go wsc.writePump()
 	wsc.readPump()
 }
 
+// HandleRestConnection serves single request of ResponseTransport
 func (wsc *Conn) HandleRestConnection() {
-	r := wsc.R
+	rt := wsc.T.(ResponseTransport)
+	wsc.open()
+	defer wsc.finish(CloseInfo{Code: websocket.CloseNormalClosure})
 
-	m, err := ParseHttpRequest(r)
+	m, err := ParseHttpRequest(rt.Request())
 	if err != nil {
-		wsc.Log.Printf("Failed to parse request err=%s\n", err)
+		wsc.Log.Warnf("Failed to parse request err=%s", err)
+		wsc.notifyError(err)
+		data, _ := json.Marshal(SimpleMsg("Bad request"))
+		wsc.setHeader("Content-Type", "application/json")
+		rt.WriteResponse(http.StatusBadRequest, data)
 		return
 	}
 
-	route, found := wsc.Router.Match(m.GetPath(), m.GetMethod())
+	route, ok := wsc.route(m)
+	if !ok {
+		return
+	}
+
+	wsc.run(route, m)
+}
+
+// setHeader sets response header if transport supports it
+func (wsc *Conn) setHeader(key string, value string) {
+	if h, ok := wsc.T.(headerTransport); ok {
+		h.Header().Set(key, value)
+	}
+}
+
+// route matches request and checks route authorization. It responds in case request can not be handled
+func (wsc *Conn) route(m *Request) (*Route, bool) {
+	path := m.GetPath()
+	method := m.GetMethod()
+
+	route, found := wsc.Router.Match(path, method)
 	if !found {
 		wsc.Respond(m, SimpleMsg("Resource not found"), http.StatusNotFound)
-		return
+		observeRequest(routeNotFound, m, time.Time{})
+		return nil, false
+	}
+
+	principal, _ := wsc.Principal()
+	if err := route.Authorize(principal, method, path, m.GetParams()); err != nil {
+		code := http.StatusForbidden
+		if aerr, ok := err.(*AuthError); ok {
+			code = aerr.Code
+		}
+		route.accessDenied(wsc, m, err)
+		wsc.Respond(m, SimpleMsg(err.Error()), code)
+		observeRequest(route.path, m, time.Time{})
+		return nil, false
+	}
+
+	if !wsc.allow(route, m) {
+		observeRequest(route.path, m, time.Time{})
+		return nil, false
 	}
 
+	return route, true
+}
+
+// run runs route handler and recovers from its panic. Request is responded with 500 and connection stays alive
+func (wsc *Conn) run(route *Route, m *Request) {
+	start := time.Now()
+	ctx := tracing.ContextWithTraceParent(m.Context(), m.TraceParent)
+	ctx, span := tracing.Start(ctx, m.GetMethod()+" "+route.path, tracing.SpanKindServer)
+	span.SetAttribute("wsrest.uid", m.GetUID())
+	span.SetAttribute("wsrest.route", route.path)
+	span.SetAttribute("wsrest.transport", wsc.transportName())
+	m.ctx = ctx
+
+	defer func() {
+		v := recover()
+		defer func() {
+			span.SetAttribute("wsrest.code", m.GetCode())
+			span.End()
+		}()
+
+		if v == nil {
+			observeRequest(route.path, m, start)
+			return
+		}
+		span.SetError(fmt.Errorf("panic: %v", v))
+
+		stack := debug.Stack()
+		wsc.Log.Errorf("Handler panic recovered uid=%s path=%s remote=%s panic=%v\n%s", m.GetUID(), m.GetPath(), wsc.GetRemoteAddr(), v, stack)
+		if wsc.PanicHandler != nil {
+			wsc.PanicHandler(wsc, m, v, stack)
+		}
+		wsc.Respond(m, SimpleMsg("Internal server error"), http.StatusInternalServerError)
+		observeRequest(route.path, m, start)
+	}()
+
 	route.Run(wsc, m)
 }
 
-func (wsc *Conn) SetLogger(l logrus.FieldLogger) {
-	wsc.Log = l
+// SetLogger sets connection logger. Connection id, remote address and principal are added as fields.
+// It is safe to call it while connection is served
+func (wsc *Conn) SetLogger(l logger.Logger) {
+	fl := l.WithFields(wsc.logFields())
+	wsc.logMutex.Lock()
+	wsc.baseLog = l
+	wsc.fieldLog = fl
+	wsc.logMutex.Unlock()
+}
+
+func (wsc *Conn) logFields() logger.Fields {
+	fields := logger.Fields{
+		"conn":      wsc.ID,
+		"remote":    wsc.GetRemoteAddr(),
+		"transport": wsc.transportName(),
+	}
+	if p, ok := wsc.Principal(); ok {
+		fields["principal"] = p.ID
+	}
+	return fields
 }
 
+// connLogger is default Conn.Log. Fields change when principal is set, so current logger is read on every call
+type connLogger struct {
+	wsc *Conn
+}
+
+func (l connLogger) current() logger.Logger {
+	l.wsc.logMutex.RLock()
+	defer l.wsc.logMutex.RUnlock()
+	if l.wsc.fieldLog == nil {
+		return logger.Nop()
+	}
+	return l.wsc.fieldLog
+}
+
+func (l connLogger) Debugf(format string, args ...interface{}) { l.current().Debugf(format, args...) }
+func (l connLogger) Infof(format string, args ...interface{})  { l.current().Infof(format, args...) }
+func (l connLogger) Warnf(format string, args ...interface{})  { l.current().Warnf(format, args...) }
+func (l connLogger) Errorf(format string, args ...interface{}) { l.current().Errorf(format, args...) }
+func (l connLogger) WithFields(fields logger.Fields) logger.Logger {
+	return l.current().WithFields(fields)
+}
+
+// SetVar sets connection variable. With session vars are kept by session, and Vars only has ones set before session is attached
 func (wsc *Conn) SetVar(name string, value interface{}) {
 	wsc.Lock()
 	defer wsc.Unlock()
+	if wsc.session != nil {
+		wsc.session.setVar(name, value)
+		return
+	}
 	wsc.Vars[name] = value
 }
 
 func (wsc *Conn) GetVar(name string) (value interface{}, exists bool) {
 	wsc.RLock()
 	defer wsc.RUnlock()
+	if wsc.session != nil {
+		return wsc.session.getVar(name)
+	}
 	value, exists = wsc.Vars[name]
 	return
 }
@@ -159,9 +330,34 @@ func (wsc *Conn) GetVar(name string) (value interface{}, exists bool) {
 func (wsc *Conn) DelVar(name string) {
 	wsc.Lock()
 	defer wsc.Unlock()
+	if wsc.session != nil {
+		wsc.session.delVar(name)
+		return
+	}
 	delete(wsc.Vars, name)
 }
 
+// SetPrincipal sets identity of connection and adds it to logger fields
+func (wsc *Conn) SetPrincipal(p *Principal) {
+	wsc.Lock()
+	wsc.principal = p
+	wsc.Unlock()
+
+	wsc.logMutex.RLock()
+	base := wsc.baseLog
+	wsc.logMutex.RUnlock()
+	if base != nil {
+		wsc.SetLogger(base)
+	}
+}
+
+// Principal returns identity set by Authenticator. Returns false for anonymous connection
+func (wsc *Conn) Principal() (*Principal, bool) {
+	wsc.RLock()
+	defer wsc.RUnlock()
+	return wsc.principal, wsc.principal != nil
+}
+
 func (wsc *Conn) AddCloseHandler(fn ConnCloseHandlerFn) {
 	wsc.CloseHandlers = append(wsc.CloseHandlers, fn)
 }
@@ -173,23 +369,37 @@ func (wsc *Conn) RunCloseHandlers() {
 }
 
 func (wsc *Conn) WriteJSON(v interface{}) error {
-	if wsc.C != nil {
-		return wsc.C.WriteJSON(v)
-	}
-
-	m, err := json.Marshal(v)
+	data, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
 
-	_, werr := wsc.W.Write(m)
-	return werr
+	state := wsc.State()
+	if _, ok := wsc.T.(ResponseTransport); ok || state == StateConnecting {
+		return wsc.T.WriteFrame(data)
+	}
+
+	wsc.RLock()
+	opened := wsc.opened
+	wsc.RUnlock()
+	if state >= StateClosing && !opened {
+		//Closed before pumps were started
+		return fmt.Errorf("Connection is closed while trying to write data")
+	}
+
+	//Write pump is running, or is still writing queued messages while closing. WE CAN NOT HAVE CONCURENT WRITES
+	return wsc.WriteWS(data)
 }
 
 func (wsc *Conn) WriteWS(data []byte) error {
+	metricSendQueue.Inc()
+	defer metricSendQueue.Dec()
+
 	select {
 	case <-wsc.StopCh:
 		return fmt.Errorf("Connection is closed while trying to write data")
+	case <-wsc.writeDone:
+		return fmt.Errorf("Connection is closed while trying to write data")
 	case wsc.SendCh <- data:
 	}
 	return nil
@@ -200,32 +410,31 @@ func (wsc *Conn) Respond(m *Request, response interface{}, status int) {
 
 	rdata, err := wsc.marshaler.Marshal(response)
 	if err != nil {
-		wsc.Log.Printf("Failed to marshal response uid=%s err=%s\n", m.GetUID(), err)
+		wsc.Log.Errorf("Failed to marshal response uid=%s err=%s", m.GetUID(), err)
 		return
 	}
 	m.SetData(rdata)
 
-	if wsc.C != nil {
-		rdata, err := wsc.marshaler.Marshal(m)
+	rt, ok := wsc.T.(ResponseTransport)
+	if !ok {
+		//Request headers are not echoed in response
+		res := *m
+		res.Header = nil
+		rdata, err := wsc.marshaler.Marshal(&res)
 		if err != nil {
-			wsc.Log.Printf("Failed to marshal request uid=%s err=%s\n", m.GetUID(), err)
+			wsc.Log.Errorf("Failed to marshal request uid=%s err=%s", m.GetUID(), err)
 			return
 		}
 
 		//This will responded by write pump, WE CAN NOT HAVE CONCURENT WRITES
 		if err := wsc.WriteWS(rdata); err != nil {
-			wsc.Log.Printf("Connection is closed. Failed to response request uid=%s err=%s\n", m.GetUID(), err)
+			wsc.Log.Warnf("Connection is closed. Failed to response request uid=%s err=%s", m.GetUID(), err)
 		}
 		return
 	}
 
-	if wsc.R.Response != nil {
-		wsc.R.Response.StatusCode = int(status)
-	}
-
-	wsc.W.WriteHeader(int(status))
-	if _, err := wsc.W.Write(rdata); err != nil {
-		wsc.Log.Printf("err: %s\n", err)
+	if err := rt.WriteResponse(status, rdata); err != nil {
+		wsc.Log.Errorf("err: %s", err)
 		return
 	}
 }
@@ -237,69 +446,121 @@ func (wsc *Conn) RespondMultiple(m *Request, response interface{}, status int) {
 }
 
 func (wsc *Conn) GetRemoteAddr() string {
-	if wsc.C != nil {
-		return wsc.C.RemoteAddr().String()
-	}
-
-	return wsc.R.RemoteAddr
+	return wsc.T.RemoteAddr()
 }
 
-func (wsc *Conn) Close() {
+// Close closes connection with websocket close code and reason. Already queued messages are sent before close,
+// while requests waiting for dispatch are dropped. It is safe to call it multiple times and on REST connection
+func (wsc *Conn) Close(code int, reason string) {
+	state := wsc.State()
+	for {
+		if state >= StateClosing {
+			return
+		}
+		if wsc.setState(state, StateClosing) {
+			break
+		}
+		state = wsc.State()
+	}
+	wsc.queue.close()
+
 	wsc.Lock()
-	wsc.Closed = true
-	wsc.C.Close()
+	wsc.closeInfo = &CloseInfo{Code: code, Reason: reason}
 	wsc.Unlock()
-	wsc.RunCloseHandlers()
-	wsc.Log.Println("Connection is closed")
+
+	if _, ok := wsc.T.(ResponseTransport); !ok && state == StateOpen {
+		//Pumps are running and they will finish connection
+		wsc.closeWS(code, reason)
+		return
+	}
+
+	wsc.T.Close(code, reason)
+	wsc.finish(CloseInfo{})
+}
+
+// closeWS closes transport after all already queued messages are written
+func (wsc *Conn) closeWS(code int, reason string) {
+	select {
+	case <-wsc.StopCh:
+	case <-wsc.writeDone:
+	case wsc.closeCh <- CloseInfo{Code: code, Reason: reason}:
+	}
 }
 
 func (wsc *Conn) readPump() {
+	var readErr error
 	defer func() {
 		// Before we exit we need to shutdown and write pump channel. Write pump channel should then stopp all seneders
-		wsc.Log.Println("Read routine closed. Closing send channel....")
+		wsc.Log.Debugf("Read routine closed. Closing send channel....")
 		close(wsc.StopCh) //Close senders
 		// close(wsc.sendCh) //Close write pump
+		info := readCloseInfo(readErr)
+		if info.Err != nil && wsc.State() != StateClosing {
+			wsc.notifyError(info.Err)
+		}
+		wsc.finish(info)
 	}()
-	// wsc.C.SetReadLimit(wsc.MaxMessageSize)
-	wsc.C.SetReadDeadline(time.Now().Add(pongWait))
-	wsc.C.SetPongHandler(func(string) error { wsc.C.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
-		_, message, err := wsc.C.ReadMessage()
+		message, err := wsc.T.ReadFrame()
 		if err != nil {
-			wsc.Log.Printf("closed upon trying to read message. err=%s Exiting ...\n", err)
+			wsc.Log.Debugf("closed upon trying to read message. err=%s Exiting ...", err)
+			readErr = err
 			break
 		}
 
 		m := &Request{}
 		if err := json.Unmarshal(message, m); err != nil {
-			wsc.Log.Printf("Unmarshal request failed. err=%s\n", err)
+			wsc.Log.Warnf("Unmarshal request failed. err=%s", err)
+			wsc.notifyError(err)
 			continue
 		}
 
-		path := m.GetPath()
-		method := m.GetMethod()
-		wsc.Log.Printf("Mathing request. path=%s method=%s\n", path, method)
+		wsc.Log.Debugf("Mathing request. path=%s method=%s", m.GetPath(), m.GetMethod())
 
-		route, found := wsc.Router.Match(path, method)
-		if !found {
-			wsc.Respond(m, SimpleMsg("Resource not found"), http.StatusNotFound)
+		route, ok := wsc.route(m)
+		if !ok {
 			continue
 		}
 
-		//TODO MAX 8192 go routines
-		go route.Run(wsc, m)
+		wsc.dispatch(route, m)
 	}
 }
 
 func (wsc *Conn) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	var ping <-chan time.Time
+	if _, ok := wsc.T.(Pinger); ok {
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	var writeErr error
 	defer func() {
-		ticker.Stop()
-		wsc.C.Close()
-		wsc.Log.Println("Write routine closed.")
+		wsc.T.Close(websocket.CloseNormalClosure, "")
+		close(wsc.writeDone)
+		wsc.Log.Debugf("Write routine closed.")
+		//Hooks run after pump is done, so they can close connection
+		if writeErr != nil {
+			wsc.notifyError(writeErr)
+		}
 	}()
 
-	wsc.Log.Println("Write routine started")
+	wsc.Log.Debugf("Write routine started")
+
+	wsc.Lock()
+	replay, session, sessionBuffer := wsc.replay, wsc.session, wsc.sessionBuffer
+	wsc.replay = nil
+	wsc.Unlock()
+
+	//Frames missed by client of resumed session are sent before anything else
+	for _, message := range replay {
+		if err := wsc.T.WriteFrame(message); err != nil {
+			wsc.Log.Warnf("Replay write err , exiting. err = %s", err)
+			writeErr = err
+			return
+		}
+	}
+
 	for {
 		select {
 		case <-wsc.StopCh:
@@ -307,22 +568,28 @@ func (wsc *Conn) writePump() {
 			return
 
 		case message, ok := <-wsc.SendCh:
-			wsc.C.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The hub closed the channel.
-				wsc.Log.Println("Send channel is closed, trying to notify ")
-				wsc.C.WriteMessage(websocket.CloseMessage, []byte{})
+				wsc.Log.Debugf("Send channel is closed, trying to notify ")
 				return
 			}
 
-			if err := wsc.C.WriteMessage(websocket.TextMessage, message); err != nil {
-				wsc.Log.Printf("Write err , exiting. err = %s\n", err)
+			if err := wsc.T.WriteFrame(message); err != nil {
+				wsc.Log.Warnf("Write err , exiting. err = %s", err)
+				writeErr = err
 				return
 			}
 
-		case <-ticker.C:
-			wsc.C.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := wsc.C.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+			if session != nil {
+				session.recordFrom(wsc, message, sessionBuffer)
+			}
+
+		case info := <-wsc.closeCh:
+			wsc.T.Close(info.Code, info.Reason)
+			return
+
+		case <-ping:
+			if err := wsc.T.(Pinger).Ping(); err != nil {
 				return
 			}
 		}
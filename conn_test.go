@@ -1,14 +1,20 @@
 package wsrest
 
 import (
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
+	"wsrest/logger"
+	"wsrest/metrics"
 
+	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -269,3 +275,118 @@ func TestRESTRequestResponse(t *testing.T) {
 func TestWebsocketRequestResponse(t *testing.T) {
 	suite.Run(t, new(SuiteWebsocketRequestResponse))
 }
+
+func TestHandlerPanicRecovery(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/panic", func(c *Conn, m *Request) {
+		panic("handler failed")
+	})
+	router.HandleFunc("/hello", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("Hello"), http.StatusOK)
+	})
+
+	panics := make(chan interface{}, 1)
+	h := NewHandler(router)
+	h.PanicHandler = func(c *Conn, m *Request, v interface{}, stack []byte) {
+		panics <- v
+	}
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	client, err := Dial(strings.Replace(server.URL, "http", "ws", 1), nil)
+	require.Nil(t, err)
+	defer client.Close()
+
+	resp, err := client.Get("/panic", nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "handler failed", <-panics)
+
+	//Connection must stay alive
+	resp, err = client.Get("/hello", nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	//Same for REST
+	hresp, err := http.Get(server.URL + "/panic")
+	require.Nil(t, err)
+	hresp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, hresp.StatusCode)
+	assert.Equal(t, "handler failed", <-panics)
+}
+
+func TestConnLoggerFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := httptest.NewRequest("GET", "/", nil)
+	wsc, err := NewConnRest(httptest.NewRecorder(), r, NewRouter())
+	require.Nil(t, err)
+
+	wsc.SetLogger(logger.NewSlog(slog.New(slog.NewTextHandler(buf, nil))))
+	wsc.SetPrincipal(&Principal{ID: "john"})
+	wsc.Log.Infof("hello")
+
+	out := buf.String()
+	assert.Contains(t, out, "conn="+wsc.ID)
+	assert.Contains(t, out, "remote="+r.RemoteAddr)
+	assert.Contains(t, out, "principal=john")
+	assert.Contains(t, out, "transport=rest")
+}
+
+func TestRequestMetrics(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/metered", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("ok"), http.StatusCreated)
+	})
+
+	server := httptest.NewServer(NewHandler(router))
+	defer server.Close()
+
+	before := metricRequests.Value("/metered", "POST", "201")
+	observed := metricRequestDuration.Count("/metered", "POST")
+	resp, err := http.Post(server.URL+"/metered", "application/json", nil)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, before+1, metricRequests.Value("/metered", "POST", "201"))
+	assert.Equal(t, observed+1, metricRequestDuration.Count("/metered", "POST"))
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `wsrest_requests_total{route="/metered",method="POST",code="201"} `)
+
+	//Methods sent by client are not used as label as is
+	other := metricRequests.Value("/metered", "other", "201")
+	observeRequest("/metered", &Request{Method: "RANDOM1", Code: http.StatusCreated}, time.Time{})
+	assert.Equal(t, other+1, metricRequests.Value("/metered", "other", "201"))
+	assert.Equal(t, float64(0), metricRequests.Value("/metered", "RANDOM1", "201"))
+}
+
+func TestConnSetPrincipalServed(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/login", func(c *Conn, m *Request) {
+		c.SetPrincipal(&Principal{ID: m.GetUID()})
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	})
+
+	client, server := NewPipe()
+	defer client.Close(websocket.CloseNormalClosure, "")
+	wsc := NewConn(server, router)
+	wsc.SetLogger(logger.Nop())
+	wsc.SetDispatchMode(DispatchConcurrent, nil)
+	go wsc.Serve()
+
+	//Pumps and handlers log while principal is changed
+	for i := 0; i < 10; i++ {
+		req, _ := NewRequest("POST", "/login", nil)
+		data, _ := json.Marshal(req)
+		require.Nil(t, client.WriteFrame(data))
+	}
+	for i := 0; i < 10; i++ {
+		_, err := client.ReadFrame()
+		require.Nil(t, err)
+	}
+	p, ok := wsc.Principal()
+	assert.True(t, ok)
+	assert.NotEmpty(t, p.ID)
+}
@@ -6,8 +6,16 @@ type Marshaler interface {
 	Marshal(v interface{}) ([]byte, error)
 }
 
+type Unmarshaler interface {
+	Unmarshal(data []byte, v interface{}) error
+}
+
 type JSONMarshaler struct{}
 
 func (m *JSONMarshaler) Marshal(v interface{}) ([]byte, error) {
 	return json.Marshal(v)
 }
+
+func (m *JSONMarshaler) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,74 @@
+package wsrest
+
+import (
+	"context"
+	"fmt"
+	"wsrest/datastream"
+)
+
+// StatusError is returned by Into helpers when response code is not 2xx
+type StatusError struct {
+	Code int
+	// Message is message of SimpleMessage body decoded with client Unmarshaler, if body is one
+	Message string
+	Body    []byte
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("Request failed with status %d: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("Request failed with status %d", e.Code)
+}
+
+func newStatusError(res *Request, u datastream.Unmarshaler) *StatusError {
+	err := &StatusError{Code: res.GetCode(), Body: res.GetData()}
+	msg := SimpleMessage{}
+	if u.Unmarshal(err.Body, &msg) == nil {
+		err.Message = msg.Message
+	}
+	return err
+}
+
+// DoInto sends request and decodes response data into out with client Unmarshaler.
+// Non 2xx response is returned as *StatusError. out can be nil when response data is not needed
+func (c *Client) DoInto(ctx context.Context, m *Request, out interface{}) error {
+	res, err := c.DoContext(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	if code := res.GetCode(); code < 200 || code > 299 {
+		return newStatusError(res, c.Unmarshaler)
+	}
+
+	data := res.GetData()
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return c.Unmarshaler.Unmarshal(data, out)
+}
+
+func (c *Client) executeInto(ctx context.Context, method string, resource string, in interface{}, out interface{}) error {
+	m, err := NewRequest(method, resource, in)
+	if err != nil {
+		return err
+	}
+	return c.DoInto(ctx, m, out)
+}
+
+func (c *Client) GetInto(ctx context.Context, resource string, out interface{}) error {
+	return c.executeInto(ctx, "GET", resource, nil, out)
+}
+
+func (c *Client) PostInto(ctx context.Context, resource string, in interface{}, out interface{}) error {
+	return c.executeInto(ctx, "POST", resource, in, out)
+}
+
+func (c *Client) PutInto(ctx context.Context, resource string, in interface{}, out interface{}) error {
+	return c.executeInto(ctx, "PUT", resource, in, out)
+}
+
+func (c *Client) DeleteInto(ctx context.Context, resource string, out interface{}) error {
+	return c.executeInto(ctx, "DELETE", resource, nil, out)
+}
@@ -0,0 +1,111 @@
+package wsrest
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Dedupe is server middleware which responds cached response to request with already seen idempotency key.
+// Keys are scoped by principal, method and path, and kept for window after response.
+// Only responses written before handler returns are cached, and 5xx responses are not cached, so request can be retried.
+// Request with same key arriving while first one is handled waits for its response.
+//
+//	router.Use(wsrest.NewDedupe(time.Minute).Middleware)
+type Dedupe struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	entries map[string]*dedupeEntry
+	swept   time.Time
+}
+
+type dedupeEntry struct {
+	done   chan struct{}
+	code   int
+	data   []byte
+	expire time.Time //Zero while request is handled
+}
+
+func NewDedupe(window time.Duration) *Dedupe {
+	return &Dedupe{
+		window:  window,
+		entries: make(map[string]*dedupeEntry),
+	}
+}
+
+func (d *Dedupe) Middleware(next RouteHandlerFn) RouteHandlerFn {
+	return func(wsc *Conn, m *Request) {
+		key := m.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			next(wsc, m)
+			return
+		}
+
+		principal := ""
+		if p, ok := wsc.Principal(); ok {
+			principal = p.ID
+		}
+		key = principal + "\x00" + m.GetMethod() + "\x00" + m.GetPath() + "\x00" + key
+
+		now := time.Now()
+		d.mutex.Lock()
+		d.sweep(now)
+		e, exists := d.entries[key]
+		if exists && !e.expire.IsZero() && now.After(e.expire) {
+			exists = false
+		}
+		if !exists {
+			e = &dedupeEntry{done: make(chan struct{})}
+			d.entries[key] = e
+		}
+		d.mutex.Unlock()
+
+		if exists {
+			<-e.done
+			if e.code != 0 {
+				wsc.Log.Debugf("Duplicate request uid=%s path=%s, responding cached response", m.GetUID(), m.GetPath())
+				wsc.Respond(m, json.RawMessage(e.data), e.code)
+				return
+			}
+			//First request was not responded, handle this one
+			next(wsc, m)
+			return
+		}
+
+		defer func() {
+			d.mutex.Lock()
+			code := m.GetCode()
+			if code == 0 || code >= 500 {
+				delete(d.entries, key)
+			} else {
+				e.code = code
+				e.data = m.GetData()
+				e.expire = time.Now().Add(d.window)
+			}
+			d.mutex.Unlock()
+			close(e.done)
+		}()
+		next(wsc, m)
+	}
+}
+
+// Len returns number of cached keys
+func (d *Dedupe) Len() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return len(d.entries)
+}
+
+// sweep removes expired entries, at most once per window. Must be called under lock
+func (d *Dedupe) sweep(now time.Time) {
+	if now.Sub(d.swept) < d.window {
+		return
+	}
+	d.swept = now
+
+	for key, e := range d.entries {
+		if !e.expire.IsZero() && now.After(e.expire) {
+			delete(d.entries, key)
+		}
+	}
+}
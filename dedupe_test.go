@@ -0,0 +1,121 @@
+package wsrest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupe(t *testing.T) {
+	var orders int32
+	var failures int32
+	dedupe := NewDedupe(time.Minute)
+	router := NewRouter()
+	router.Use(dedupe.Middleware)
+	router.HandleFunc("/orders", func(c *Conn, m *Request) {
+		n := atomic.AddInt32(&orders, 1)
+		c.Respond(m, SimpleMsg("order %d", n), http.StatusCreated)
+	})
+	router.HandleFunc("/unstable", func(c *Conn, m *Request) {
+		if atomic.AddInt32(&failures, 1) == 1 {
+			c.Respond(m, SimpleMsg("unavailable"), http.StatusServiceUnavailable)
+			return
+		}
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	})
+	c := pipeClient(t, router)
+
+	post := func(path string, key string) *Request {
+		m, _ := NewRequest("POST", path, nil)
+		if key != "" {
+			m.SetHeader(IdempotencyKeyHeader, key)
+		}
+		res, err := c.Do(m)
+		require.Nil(t, err)
+		return res
+	}
+
+	first := post("/orders", "k1")
+	second := post("/orders", "k1")
+	assert.Equal(t, http.StatusCreated, second.GetCode())
+	assert.JSONEq(t, string(first.GetData()), string(second.GetData()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&orders))
+
+	post("/orders", "k2")
+	post("/orders", "")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&orders))
+	assert.Equal(t, 2, dedupe.Len())
+
+	t.Run("ServerErrorNotCached", func(t *testing.T) {
+		assert.Equal(t, http.StatusServiceUnavailable, post("/unstable", "k3").GetCode())
+		assert.Equal(t, http.StatusOK, post("/unstable", "k3").GetCode())
+		assert.Equal(t, http.StatusOK, post("/unstable", "k3").GetCode())
+		assert.Equal(t, int32(2), atomic.LoadInt32(&failures))
+	})
+
+	t.Run("Rest", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/orders", nil)
+			r.Header.Set(IdempotencyKeyHeader, "k1")
+			wsc, err := NewConnRest(w, r, router)
+			require.Nil(t, err)
+			wsc.Serve()
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.JSONEq(t, string(first.GetData()), w.Body.String())
+		}
+		assert.Equal(t, int32(3), atomic.LoadInt32(&orders))
+	})
+
+}
+
+func TestDedupeWindow(t *testing.T) {
+	var calls int32
+	router := NewRouter()
+	router.Use(NewDedupe(20 * time.Millisecond).Middleware)
+	router.HandleFunc("/orders", func(c *Conn, m *Request) {
+		atomic.AddInt32(&calls, 1)
+		c.Respond(m, SimpleMsg("ok"), http.StatusCreated)
+	})
+	c := pipeClient(t, router)
+
+	m, _ := NewRequest("POST", "/orders", nil)
+	m.SetHeader(IdempotencyKeyHeader, "k1")
+	for i := 0; i < 2; i++ {
+		_, err := c.Do(m)
+		require.Nil(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	time.Sleep(30 * time.Millisecond)
+	_, err := c.Do(m)
+	require.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	var order []string
+	router := NewRouter()
+	router.HandleFunc("/go", func(c *Conn, m *Request) {
+		order = append(order, "handler")
+	})
+	for _, name := range []string{"first", "second"} {
+		name := name
+		router.Use(func(next RouteHandlerFn) RouteHandlerFn {
+			return func(c *Conn, m *Request) {
+				order = append(order, name)
+				next(c, m)
+			}
+		})
+	}
+
+	route, _ := router.Match("/go", "")
+	route.Run(nil, &Request{})
+	assert.Equal(t, []string{"first", "second", "handler"}, order)
+}
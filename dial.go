@@ -0,0 +1,147 @@
+package wsrest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// NetDialFn dials network connection. It is used by websocket dialer and DialNet
+type NetDialFn func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+// DialError is returned when connection could not be established.
+// Response is handshake response, when server rejected websocket upgrade
+type DialError struct {
+	Err      error
+	Response *http.Response
+}
+
+func (e *DialError) Error() string {
+	if e.Response != nil {
+		return fmt.Sprintf("%s (status %d)", e.Err, e.Response.StatusCode)
+	}
+	return e.Err.Error()
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// WithDialer sets websocket dialer used as base for other dial options. Other options are applied on it regardless of order
+func WithDialer(d *websocket.Dialer) DialOption {
+	return func(c *Client) {
+		c.baseDialer = d
+	}
+}
+
+// dialerOption changes websocket dialer, after base dialer is set
+func dialerOption(fn func(d *websocket.Dialer)) DialOption {
+	return func(c *Client) {
+		c.dialerOpts = append(c.dialerOpts, fn)
+	}
+}
+
+// buildDialer applies dialer options on base dialer
+func (c *Client) buildDialer() {
+	if c.baseDialer != nil {
+		c.dialer = *c.baseDialer
+	}
+	for _, fn := range c.dialerOpts {
+		fn(&c.dialer)
+	}
+	c.dialerOpts = nil
+}
+
+// WithNetDial sets function dialing network connection, for websocket and DialNet
+func WithNetDial(fn NetDialFn) DialOption {
+	return func(c *Client) {
+		c.netDial = fn
+		dialerOption(func(d *websocket.Dialer) {
+			d.NetDialContext = fn
+		})(c)
+	}
+}
+
+// WithHeader adds header sent in websocket upgrade request, like Authorization
+func WithHeader(key string, value string) DialOption {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// WithTLSConfig sets TLS config, for example with client certificates. DialNet uses it on tcp network
+func WithTLSConfig(cfg *tls.Config) DialOption {
+	return dialerOption(func(d *websocket.Dialer) {
+		d.TLSClientConfig = cfg
+	})
+}
+
+// WithSubprotocols sets requested websocket subprotocols. Negotiated one is returned by Client.Subprotocol
+func WithSubprotocols(protocols ...string) DialOption {
+	return dialerOption(func(d *websocket.Dialer) {
+		d.Subprotocols = protocols
+	})
+}
+
+// WithProxy sets proxy of websocket connection. Use http.ProxyURL for fixed proxy
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) DialOption {
+	return dialerOption(func(d *websocket.Dialer) {
+		d.Proxy = proxy
+	})
+}
+
+// WithHandshakeTimeout limits time for connecting and websocket handshake
+func WithHandshakeTimeout(timeout time.Duration) DialOption {
+	return dialerOption(func(d *websocket.Dialer) {
+		d.HandshakeTimeout = timeout
+	})
+}
+
+// Subprotocol returns websocket subprotocol negotiated with server
+func (c *Client) Subprotocol() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.subprotocol
+}
+
+// dialNet dials TCP or unix connection respecting handshake timeout, net dial and TLS options
+func (c *Client) dialNet(network string, addr string) (net.Conn, error) {
+	ctx := context.Background()
+	if c.dialer.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.dialer.HandshakeTimeout)
+		defer cancel()
+	}
+
+	dial := c.netDial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, &DialError{Err: err}
+	}
+
+	cfg := c.dialer.TLSClientConfig
+	if cfg == nil || network == "unix" {
+		return conn, nil
+	}
+
+	if cfg.ServerName == "" {
+		cfg = cfg.Clone()
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tconn := tls.Client(conn, cfg)
+	if err := tconn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, &DialError{Err: err}
+	}
+	return tconn, nil
+}
@@ -0,0 +1,149 @@
+package wsrest
+
+import "sync"
+
+// DispatchMode controls how websocket requests of single connection are processed
+type DispatchMode int
+
+const (
+	// DispatchDefault on route inherits connection mode. On connection it is same as DispatchConcurrent
+	DispatchDefault DispatchMode = iota
+	// DispatchConcurrent runs every request in its own go routine
+	DispatchConcurrent
+	// DispatchSerial processes requests one by one in arrival order
+	DispatchSerial
+	// DispatchKeyed processes requests with same key in arrival order, while different keys run concurrently
+	DispatchKeyed
+)
+
+// DispatchKeyFn returns key used by DispatchKeyed mode
+type DispatchKeyFn func(m *Request) string
+
+// PathKey is default DispatchKeyFn, serializing requests on same resource path
+func PathKey(m *Request) string {
+	return m.GetPath()
+}
+
+const serialQueueKey = "\x00serial"
+
+// DispatchQueueSize is maximum number of requests queued on connection in serial and keyed modes.
+// When queue is full, connection stops reading requests until there is room
+const DispatchQueueSize = 1024
+
+// keyedQueue runs functions with same key in order. Every active key has single go routine
+type keyedQueue struct {
+	mutex   sync.Mutex
+	queues  map[string][]func()
+	room    *sync.Cond
+	max     int //Max queued functions, not counting running ones. Zero is unlimited
+	pending int
+	closed  bool
+}
+
+// push queues fn, waiting while queue is full. It returns false if queue is closed and fn is dropped
+func (q *keyedQueue) push(key string, fn func()) bool {
+	return q.add(key, fn, true)
+}
+
+// tryPush queues fn without waiting. It returns false if queue is full or closed and fn is dropped
+func (q *keyedQueue) tryPush(key string, fn func()) bool {
+	return q.add(key, fn, false)
+}
+
+func (q *keyedQueue) add(key string, fn func(), wait bool) bool {
+	q.mutex.Lock()
+	if q.queues == nil {
+		q.queues = make(map[string][]func())
+		q.room = sync.NewCond(&q.mutex)
+	}
+
+	for wait && q.max > 0 && q.pending >= q.max && !q.closed {
+		q.room.Wait()
+	}
+	if q.closed || (q.max > 0 && q.pending >= q.max) {
+		q.mutex.Unlock()
+		return false
+	}
+
+	if pending, active := q.queues[key]; active {
+		q.queues[key] = append(pending, fn)
+		q.pending++
+		q.mutex.Unlock()
+		return true
+	}
+	q.queues[key] = nil
+	q.mutex.Unlock()
+
+	go q.run(key, fn)
+	return true
+}
+
+func (q *keyedQueue) run(key string, fn func()) {
+	for {
+		fn()
+
+		q.mutex.Lock()
+		pending := q.queues[key]
+		if len(pending) == 0 {
+			delete(q.queues, key)
+			q.mutex.Unlock()
+			return
+		}
+		fn = pending[0]
+		q.queues[key] = pending[1:]
+		q.pending--
+		q.room.Broadcast()
+		q.mutex.Unlock()
+	}
+}
+
+// close drops queued functions. Running ones are finished, and later pushes are dropped
+func (q *keyedQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	for key := range q.queues {
+		q.queues[key] = nil
+	}
+	q.pending = 0
+	if q.room != nil {
+		q.room.Broadcast()
+	}
+}
+
+// SetDispatchMode sets how requests on this connection are processed. keyFn is used only for DispatchKeyed, nil means PathKey
+func (wsc *Conn) SetDispatchMode(mode DispatchMode, keyFn DispatchKeyFn) {
+	wsc.Lock()
+	defer wsc.Unlock()
+	wsc.dispatchMode = mode
+	wsc.dispatchKey = keyFn
+}
+
+// dispatch runs route handler respecting route or connection dispatch mode
+func (wsc *Conn) dispatch(route *Route, m *Request) {
+	wsc.RLock()
+	mode, keyFn := wsc.dispatchMode, wsc.dispatchKey
+	wsc.RUnlock()
+
+	if route.dispatchMode != DispatchDefault {
+		mode, keyFn = route.dispatchMode, route.dispatchKey
+	}
+
+	run := func() { wsc.run(route, m) }
+	switch mode {
+	case DispatchSerial:
+		if !wsc.queue.push(serialQueueKey, run) {
+			wsc.Log.Debugf("Connection is closed, request dropped uid=%s", m.GetUID())
+		}
+	case DispatchKeyed:
+		if keyFn == nil {
+			keyFn = PathKey
+		}
+		if !wsc.queue.push(keyFn(m), run) {
+			wsc.Log.Debugf("Connection is closed, request dropped uid=%s", m.GetUID())
+		}
+	default:
+		//TODO MAX 8192 go routines
+		go run()
+	}
+}
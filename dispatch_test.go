@@ -0,0 +1,172 @@
+package wsrest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedQueue(t *testing.T) {
+	q := &keyedQueue{}
+	var mutex sync.Mutex
+	result := []int{}
+	wg := sync.WaitGroup{}
+
+	block := make(chan struct{})
+	wg.Add(1)
+	q.push("blocked", func() {
+		<-block
+		wg.Done()
+	})
+
+	for i := 0; i < 100; i++ {
+		i := i
+		wg.Add(1)
+		q.push("ordered", func() {
+			mutex.Lock()
+			result = append(result, i)
+			mutex.Unlock()
+			wg.Done()
+		})
+	}
+
+	//Other keys must not wait blocked one
+	time.Sleep(10 * time.Millisecond)
+	mutex.Lock()
+	assert.Equal(t, 100, len(result))
+	mutex.Unlock()
+	close(block)
+	wg.Wait()
+
+	for i, v := range result {
+		require.Equal(t, i, v)
+	}
+	assert.Eventually(t, func() bool {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		return len(q.queues) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestKeyedDispatch(t *testing.T) {
+	router := NewRouter()
+	value := ""
+	router.HandleFunc("/resource", func(c *Conn, m *Request) {
+		if m.Method == "PUT" {
+			time.Sleep(20 * time.Millisecond)
+			value = string(m.GetData())
+		}
+		c.Respond(m, SimpleMsg(value), http.StatusOK)
+	})
+
+	h := NewHandler(router)
+	h.Dispatch = DispatchKeyed
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(server.URL, "http", "ws", 1), nil)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	put, _ := NewRequest("PUT", "/resource", "42")
+	get, _ := NewRequest("GET", "/resource", nil)
+	require.Nil(t, conn.WriteJSON(put))
+	require.Nil(t, conn.WriteJSON(get))
+
+	for _, uid := range []string{put.UID, get.UID} {
+		res := &Request{}
+		require.Nil(t, conn.ReadJSON(res))
+		assert.Equal(t, uid, res.UID)
+		assert.Equal(t, `{"message":"42"}`, string(res.GetData()))
+	}
+}
+
+func TestSerialDispatch(t *testing.T) {
+	router := NewRouter()
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	router.HandleFunc("/serial", func(c *Conn, m *Request) {
+		started <- m.UID
+		<-release
+		c.Respond(m, nil, http.StatusOK)
+	})
+
+	client, server := NewPipe()
+	defer client.Close(websocket.CloseNormalClosure, "")
+	wsc := NewConn(server, router)
+	wsc.SetDispatchMode(DispatchSerial, nil)
+	wsc.queue.max = 2
+	go wsc.Serve()
+
+	uids := []string{}
+	for i := 0; i < 5; i++ {
+		req, _ := NewRequest("GET", "/serial", nil)
+		data, _ := json.Marshal(req)
+		require.Nil(t, client.WriteFrame(data))
+		uids = append(uids, req.UID)
+	}
+
+	//One running, two queued, and read pump waits for room
+	assert.Equal(t, uids[0], <-started)
+	assert.Eventually(t, func() bool {
+		wsc.queue.mutex.Lock()
+		defer wsc.queue.mutex.Unlock()
+		return wsc.queue.pending == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 0, len(started))
+
+	close(release)
+	for _, uid := range uids {
+		data, err := client.ReadFrame()
+		require.Nil(t, err)
+		res := &Request{}
+		require.Nil(t, json.Unmarshal(data, res))
+		assert.Equal(t, uid, res.UID)
+	}
+}
+
+func TestSerialDispatchClose(t *testing.T) {
+	router := NewRouter()
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	router.HandleFunc("/serial", func(c *Conn, m *Request) {
+		started <- m.UID
+		<-release
+	})
+
+	client, server := NewPipe()
+	wsc := NewConn(server, router)
+	wsc.SetDispatchMode(DispatchSerial, nil)
+	done := make(chan struct{})
+	go func() {
+		wsc.Serve()
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		req, _ := NewRequest("GET", "/serial", nil)
+		data, _ := json.Marshal(req)
+		require.Nil(t, client.WriteFrame(data))
+	}
+	<-started
+	assert.Eventually(t, func() bool {
+		wsc.queue.mutex.Lock()
+		defer wsc.queue.mutex.Unlock()
+		return wsc.queue.pending == 2
+	}, time.Second, time.Millisecond)
+
+	//Queued requests are dropped on close
+	client.Close(websocket.CloseNormalClosure, "")
+	<-done
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, len(started))
+}
@@ -0,0 +1,119 @@
+package wsrest
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"wsrest/datastream"
+	"wsrest/pubsub"
+)
+
+// PushEvent is event pushed by server. Raw frame can be decoded into user struct with Decode
+type PushEvent struct {
+	pubsub.Event
+	Raw         []byte
+	unmarshaler datastream.Unmarshaler
+}
+
+// Decode decodes whole event frame into v
+func (e *PushEvent) Decode(v interface{}) error {
+	return e.unmarshaler.Unmarshal(e.Raw, v)
+}
+
+type EventHandlerFn func(e *PushEvent)
+
+const eventQueueKey = "events"
+
+// EventMux dispatches frames pushed by server to handlers registered by event topic and type.
+// Most specific handler is called: topic and type, then topic only, then type only.
+// Frames which are not events or have no handler go to fallback handler.
+// Handlers are called one by one in frame arrival order, on other go routine than client reading,
+// so they can make requests on client. Use Serve as Dial ReadHandler.
+// At most DispatchQueueSize frames wait for slow handler. Frames over it are dropped, so client reading is not blocked
+type EventMux struct {
+	mutex       sync.RWMutex
+	handlers    map[[2]string]EventHandlerFn
+	fallback    ReadHandler
+	queue       keyedQueue
+	dropped     uint64
+	Unmarshaler datastream.Unmarshaler
+}
+
+func NewEventMux() *EventMux {
+	mux := &EventMux{
+		handlers:    make(map[[2]string]EventHandlerFn),
+		Unmarshaler: &datastream.JSONMarshaler{},
+	}
+	mux.queue.max = DispatchQueueSize
+	return mux
+}
+
+// Handle registers handler for topic and type. Empty topic or type matches any
+func (mux *EventMux) Handle(topic string, typ string, fn EventHandlerFn) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.handlers[[2]string{topic, typ}] = fn
+}
+
+func (mux *EventMux) HandleTopic(topic string, fn EventHandlerFn) {
+	mux.Handle(topic, "", fn)
+}
+
+func (mux *EventMux) HandleType(typ string, fn EventHandlerFn) {
+	mux.Handle("", typ, fn)
+}
+
+// Fallback sets handler of frames without event handler
+func (mux *EventMux) Fallback(fn ReadHandler) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.fallback = fn
+}
+
+// Serve queues frame for dispatching. It is ReadHandler
+func (mux *EventMux) Serve(data []byte) {
+	queued := mux.queue.tryPush(eventQueueKey, func() {
+		mux.dispatch(data)
+	})
+	if !queued {
+		atomic.AddUint64(&mux.dropped, 1)
+	}
+}
+
+// Dropped returns number of frames dropped because queue was full
+func (mux *EventMux) Dropped() uint64 {
+	return atomic.LoadUint64(&mux.dropped)
+}
+
+func (mux *EventMux) dispatch(data []byte) {
+	e := &PushEvent{Raw: data, unmarshaler: mux.Unmarshaler}
+	err := json.Unmarshal(data, &e.Event)
+	isEvent := err == nil && (e.Topic != "" || e.Type != "")
+
+	mux.mutex.RLock()
+	var fn EventHandlerFn
+	if isEvent {
+		fn = mux.match(e.Topic, e.Type)
+	}
+	fallback := mux.fallback
+	mux.mutex.RUnlock()
+
+	if fn != nil {
+		fn(e)
+		return
+	}
+
+	if fallback != nil {
+		fallback(data)
+	}
+}
+
+// match must be called under lock
+func (mux *EventMux) match(topic string, typ string) EventHandlerFn {
+	for _, key := range [][2]string{{topic, typ}, {topic, ""}, {"", typ}} {
+		if fn, exists := mux.handlers[key]; exists {
+			return fn
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package wsrest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+	"wsrest/pubsub"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventMux(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/push", func(c *Conn, m *Request) {
+		c.WriteJSON(pubsub.Event{Type: "created", Topic: "users", TopicId: "1"})
+		c.WriteJSON(pubsub.Event{Type: "deleted", Topic: "users", TopicId: "2"})
+		c.WriteJSON(pubsub.Event{Type: "created", Topic: "orders", TopicId: "3"})
+		c.WriteJSON(pubsub.Event{Type: "other", Topic: "other", TopicId: "4"})
+		c.WriteJSON(map[string]string{"hello": "world"})
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	})
+	router.HandleFunc("/ping", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("pong"), http.StatusOK)
+	})
+
+	mux := NewEventMux()
+	got := make(chan string, 10)
+
+	client, server := NewPipe()
+	wsc := NewConn(server, router)
+	go wsc.Serve()
+	c := NewClient(client, mux.Serve)
+	t.Cleanup(c.Close)
+
+	mux.Handle("users", "deleted", func(e *PushEvent) {
+		got <- "users deleted " + e.TopicId
+	})
+	mux.HandleTopic("users", func(e *PushEvent) {
+		//Handlers can make requests on client
+		res, err := c.Get("/ping", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.GetCode())
+		got <- "users " + e.TopicId
+	})
+	mux.HandleType("created", func(e *PushEvent) {
+		var user struct {
+			ID string `json:"topic_id"`
+		}
+		require.NoError(t, e.Decode(&user))
+		got <- "created " + user.ID
+	})
+	mux.Fallback(func(data []byte) {
+		got <- "fallback " + string(data)
+	})
+
+	res, err := c.Get("/push", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.GetCode())
+
+	expected := []string{
+		"users 1",
+		"users deleted 2",
+		"created 3",
+		`fallback {"type":"other","application":"","topic":"other","topic_id":"4","timestamp":null}`,
+		`fallback {"hello":"world"}`,
+	}
+	for _, e := range expected {
+		select {
+		case g := <-got:
+			assert.Equal(t, e, g)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Event %q not delivered", e)
+		}
+	}
+}
+
+func TestEventMuxOrder(t *testing.T) {
+	mux := NewEventMux()
+	got := make(chan string, 100)
+	mux.HandleType("tick", func(e *PushEvent) {
+		time.Sleep(time.Millisecond)
+		got <- e.TopicId
+	})
+
+	ids := []string{}
+	for i := 0; i < 20; i++ {
+		id := string(rune('a' + i))
+		ids = append(ids, id)
+		mux.Serve([]byte(`{"type":"tick","topic_id":"` + id + `"}`))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, id := range ids {
+		select {
+		case g := <-got:
+			assert.Equal(t, id, g)
+		case <-ctx.Done():
+			t.Fatal("Events not delivered")
+		}
+	}
+}
+
+func TestEventMuxSlowHandler(t *testing.T) {
+	mux := NewEventMux()
+	mux.queue.max = 2
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	mux.HandleType("tick", func(e *PushEvent) {
+		started <- struct{}{}
+		<-release
+	})
+
+	mux.Serve([]byte(`{"type":"tick"}`))
+	<-started
+	//Two frames wait, rest are dropped without blocking
+	for i := 0; i < 5; i++ {
+		mux.Serve([]byte(`{"type":"tick"}`))
+	}
+	assert.Equal(t, uint64(3), mux.Dropped())
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		<-started
+	}
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 0, len(started))
+}
@@ -12,7 +12,7 @@ func main() {
 
 	fmt.Println("Running client")
 	c, err := wsrest.Dial("ws://127.0.0.1:3000/ws", ReadHandler)
-	// c.SetLog(logrus.StandardLogger().WithField("test", "test"))
+	// c.SetLog(logger.NewLogrus(logrus.StandardLogger().WithField("test", "test")))
 	if err != nil {
 		fmt.Println("Fail to connect", err)
 		return
@@ -42,10 +42,10 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 		logrus.Error(err)
 		return
 	}
-	defer wsc.Close()
+	defer wsc.Close(websocket.CloseNormalClosure, "")
 
-	wsc.Log.Info("New ws client connected")
-	defer wsc.Log.Info("Client ws disconected")
+	wsc.Log.Infof("New ws client connected")
+	defer wsc.Log.Infof("Client ws disconected")
 	wsc.HandleWSConnection()
 }
 
@@ -61,8 +61,8 @@ func restHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wsc.Log.Info("New rest client connected")
-	defer wsc.Log.Info("Client rest disconected")
+	wsc.Log.Infof("New rest client connected")
+	defer wsc.Log.Infof("Client rest disconected")
 	wsc.HandleRestConnection()
 }
 
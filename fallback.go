@@ -0,0 +1,370 @@
+package wsrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Fallback transports, selected with transport query parameter
+const (
+	FallbackSSE  = "sse"
+	FallbackPoll = "poll"
+)
+
+// FallbackHandler serves router for clients which can not upgrade to websocket.
+// Frames are pushed over Server-Sent Events or HTTP long polling, and requests are sent with POST.
+// Session ID ties them together:
+//
+//	GET    ?transport=sse[&session=id]   event stream. First event is "session" with session id
+//	GET    ?transport=poll[&session=id]  JSON array of frames. Without session it only creates one
+//	POST   ?session=id                   request envelope, response is pushed on stream
+//	DELETE ?session=id                   closes session
+//
+// Session ID is also returned in SessionHeader. Connections are set up by Handler, same as websocket ones.
+type FallbackHandler struct {
+	Handler *Handler
+	// PollTimeout is how long poll waits for frames. Default 25s
+	PollTimeout time.Duration
+	// IdleTimeout closes session when no stream or poll is attached. Default 30s
+	IdleTimeout time.Duration
+	// KeepAlive is period of SSE comments keeping proxies from closing stream. Default 15s
+	KeepAlive time.Duration
+
+	mutex    sync.Mutex
+	sessions map[string]*fallbackSession
+}
+
+func NewFallbackHandler(h *Handler) *FallbackHandler {
+	return &FallbackHandler{
+		Handler:     h,
+		PollTimeout: 25 * time.Second,
+		IdleTimeout: 30 * time.Second,
+		KeepAlive:   15 * time.Second,
+		sessions:    make(map[string]*fallbackSession),
+	}
+}
+
+type fallbackSession struct {
+	mutex     sync.Mutex
+	t         *fallbackTransport
+	conn      *Conn
+	principal string
+	attached  int
+	idle      *time.Timer
+}
+
+func (h *FallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.Handler.Authenticator)
+	if !ok {
+		return
+	}
+
+	id := r.URL.Query().Get(sessionQuery)
+	if id == "" && r.Method == http.MethodGet {
+		s := h.open(r, principal)
+		id = s.t.id
+	}
+
+	s, err := h.session(id, principal)
+	if err != nil {
+		code := http.StatusNotFound
+		if aerr, ok := err.(*AuthError); ok {
+			code = aerr.Code
+		}
+		writeHTTPError(w, code, SimpleMsg(err.Error()))
+		return
+	}
+	w.Header().Set(SessionHeader, id)
+
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("transport") == FallbackPoll {
+			h.poll(w, r, s)
+			return
+		}
+		h.stream(w, r, s)
+	case http.MethodPost:
+		h.post(w, r, s)
+	case http.MethodDelete:
+		s.conn.Close(websocket.CloseNormalClosure, "")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeHTTPError(w, http.StatusMethodNotAllowed, SimpleMsg("Method not allowed"))
+	}
+}
+
+// open creates session with connection served until session is closed
+func (h *FallbackHandler) open(r *http.Request, p *Principal) *fallbackSession {
+	t := newFallbackTransport(r.RemoteAddr)
+	wsc := NewConn(t, h.Handler.Router)
+	wsc.R = r
+	wsc.SetPrincipal(p)
+	release := h.Handler.setupConn(wsc)
+
+	s := &fallbackSession{t: t, conn: wsc}
+	if p != nil {
+		s.principal = p.ID
+	}
+
+	h.mutex.Lock()
+	h.sessions[t.id] = s
+	h.mutex.Unlock()
+	s.detach(h.IdleTimeout)
+
+	go func() {
+		defer func() {
+			release()
+			h.mutex.Lock()
+			delete(h.sessions, t.id)
+			h.mutex.Unlock()
+		}()
+		wsc.HandleWSConnection()
+	}()
+	return s
+}
+
+func (h *FallbackHandler) session(id string, p *Principal) (*fallbackSession, error) {
+	h.mutex.Lock()
+	s, exists := h.sessions[id]
+	h.mutex.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("Session not found")
+	}
+
+	principal := ""
+	if p != nil {
+		principal = p.ID
+	}
+	if s.principal != principal {
+		return nil, ErrForbidden
+	}
+	return s, nil
+}
+
+// Len returns number of open sessions
+func (h *FallbackHandler) Len() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.sessions)
+}
+
+func (s *fallbackSession) attach() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attached++
+	if s.idle != nil {
+		s.idle.Stop()
+		s.idle = nil
+	}
+}
+
+// detach starts idle timer once nothing is attached
+func (s *fallbackSession) detach(timeout time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.attached > 0 {
+		s.attached--
+	}
+	if s.attached > 0 {
+		return
+	}
+	s.idle = time.AfterFunc(timeout, func() {
+		s.conn.Close(websocket.CloseGoingAway, "idle timeout")
+	})
+}
+
+func (h *FallbackHandler) stream(w http.ResponseWriter, r *http.Request, s *fallbackSession) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeHTTPError(w, http.StatusInternalServerError, SimpleMsg("Streaming not supported"))
+		return
+	}
+
+	s.attach()
+	defer s.detach(h.IdleTimeout)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	writeSSE(w, "session", []byte(s.t.id))
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(h.KeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case data := <-s.t.out:
+			writeSSE(w, "", data)
+		case <-s.t.done:
+			for _, data := range s.t.pending() {
+				writeSSE(w, "", data)
+			}
+			info, _ := json.Marshal(s.t.closeInfo())
+			writeSSE(w, "close", info)
+			flusher.Flush()
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSSE writes SSE event. Every line of data is written as own data field, so frames with new lines are not broken
+func writeSSE(w io.Writer, event string, data []byte) {
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+func (h *FallbackHandler) poll(w http.ResponseWriter, r *http.Request, s *fallbackSession) {
+	s.attach()
+	defer s.detach(h.IdleTimeout)
+
+	frames := []json.RawMessage{}
+	if r.URL.Query().Get(sessionQuery) != "" {
+		timeout := time.NewTimer(h.PollTimeout)
+		defer timeout.Stop()
+
+		select {
+		case data := <-s.t.out:
+			frames = append(frames, data)
+		case <-s.t.done:
+		case <-timeout.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for _, data := range s.t.pending() {
+		frames = append(frames, data)
+	}
+
+	select {
+	case <-s.t.done:
+		if len(frames) == 0 {
+			writeHTTPError(w, http.StatusGone, s.t.closeInfo())
+			return
+		}
+	default:
+	}
+
+	data, _ := json.Marshal(frames)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *FallbackHandler) post(w http.ResponseWriter, r *http.Request, s *fallbackSession) {
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, s.conn.MaxMessageSize))
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, SimpleMsg(err.Error()))
+		return
+	}
+
+	select {
+	case s.t.in <- data:
+		w.WriteHeader(http.StatusAccepted)
+	case <-s.t.done:
+		writeHTTPError(w, http.StatusGone, s.t.closeInfo())
+	case <-r.Context().Done():
+	}
+}
+
+// fallbackCloseMessage is sent to client when session is closed
+type fallbackCloseMessage struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// fallbackTransport queues frames between connection and HTTP requests of session
+type fallbackTransport struct {
+	id     string
+	remote string
+	in     chan []byte
+	out    chan []byte
+	done   chan struct{}
+	once   sync.Once
+	code   int
+	reason string
+}
+
+func newFallbackTransport(remote string) *fallbackTransport {
+	return &fallbackTransport{
+		id:     uuid.NewV4().String(),
+		remote: remote,
+		in:     make(chan []byte, 64),
+		out:    make(chan []byte, 256),
+		done:   make(chan struct{}),
+	}
+}
+
+func (t *fallbackTransport) ReadFrame() ([]byte, error) {
+	select {
+	case data := <-t.in:
+		return data, nil
+	case <-t.done:
+		return nil, &websocket.CloseError{Code: t.code, Text: t.reason}
+	}
+}
+
+func (t *fallbackTransport) WriteFrame(data []byte) error {
+	select {
+	case t.out <- data:
+		return nil
+	case <-t.done:
+		return fmt.Errorf("Session is closed")
+	}
+}
+
+func (t *fallbackTransport) Close(code int, reason string) error {
+	t.once.Do(func() {
+		t.code = code
+		t.reason = reason
+		close(t.done)
+	})
+	return nil
+}
+
+// pending returns frames already queued
+func (t *fallbackTransport) pending() [][]byte {
+	var frames [][]byte
+	for {
+		select {
+		case data := <-t.out:
+			frames = append(frames, data)
+		default:
+			return frames
+		}
+	}
+}
+
+// closeInfo must be called only after done is closed
+func (t *fallbackTransport) closeInfo() fallbackCloseMessage {
+	return fallbackCloseMessage{Code: t.code, Reason: t.reason}
+}
+
+func (t *fallbackTransport) RemoteAddr() string {
+	return t.remote
+}
+
+func (t *fallbackTransport) Name() string {
+	return "fallback"
+}
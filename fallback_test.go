@@ -0,0 +1,176 @@
+package wsrest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fallbackRouter() *FastRouter {
+	router := NewRouter()
+	router.HandleFunc("/echo", func(c *Conn, m *Request) {
+		c.WriteWS([]byte(`{"type":"pushed"}`))
+		c.Respond(m, SimpleMsg("echo"), http.StatusOK)
+	})
+	return router
+}
+
+func postFallback(t *testing.T, url string, id string, m *Request) {
+	data, _ := json.Marshal(m)
+	res, err := http.Post(url+"?session="+id, "application/json", bytes.NewReader(data))
+	require.Nil(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+}
+
+// readEvent reads single SSE event. Data lines are joined with new line
+func readEvent(t *testing.T, r *bufio.Reader) (event string, data string) {
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		require.Nil(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && len(lines) > 0:
+			return event, strings.Join(lines, "\n")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestFallbackSSE(t *testing.T) {
+	h := NewFallbackHandler(NewHandler(fallbackRouter()))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "?transport=sse")
+	require.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	events := bufio.NewReader(res.Body)
+
+	event, id := readEvent(t, events)
+	assert.Equal(t, "session", event)
+	assert.Equal(t, res.Header.Get(SessionHeader), id)
+	assert.Equal(t, 1, h.Len())
+
+	m, _ := NewRequest("GET", "/echo", nil)
+	postFallback(t, server.URL, id, m)
+
+	_, data := readEvent(t, events)
+	assert.Equal(t, `{"type":"pushed"}`, data)
+
+	_, data = readEvent(t, events)
+	resp := &Request{}
+	require.Nil(t, json.Unmarshal([]byte(data), resp))
+	assert.Equal(t, m.GetUID(), resp.GetUID())
+	assert.Equal(t, http.StatusOK, resp.GetCode())
+
+	req, _ := http.NewRequest("DELETE", server.URL+"?session="+id, nil)
+	dres, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	dres.Body.Close()
+	assert.Equal(t, http.StatusNoContent, dres.StatusCode)
+
+	event, data = readEvent(t, events)
+	assert.Equal(t, "close", event)
+	assert.JSONEq(t, `{"code":1000,"reason":""}`, data)
+	assert.Eventually(t, func() bool { return h.Len() == 0 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestFallbackPoll(t *testing.T) {
+	h := NewFallbackHandler(NewHandler(fallbackRouter()))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	poll := func(id string) (*http.Response, []json.RawMessage) {
+		url := server.URL + "?transport=poll"
+		if id != "" {
+			url += "&session=" + id
+		}
+		res, err := http.Get(url)
+		require.Nil(t, err)
+		defer res.Body.Close()
+
+		var frames []json.RawMessage
+		if res.StatusCode == http.StatusOK {
+			require.Nil(t, json.NewDecoder(res.Body).Decode(&frames))
+		}
+		return res, frames
+	}
+
+	res, frames := poll("")
+	id := res.Header.Get(SessionHeader)
+	require.NotEmpty(t, id)
+	assert.Len(t, frames, 0)
+
+	m, _ := NewRequest("GET", "/echo", nil)
+	postFallback(t, server.URL, id, m)
+
+	var received []json.RawMessage
+	for len(received) < 2 {
+		_, frames = poll(id)
+		received = append(received, frames...)
+	}
+	assert.JSONEq(t, `{"type":"pushed"}`, string(received[0]))
+	resp := &Request{}
+	require.Nil(t, json.Unmarshal(received[1], resp))
+	assert.Equal(t, m.GetUID(), resp.GetUID())
+
+	t.Run("UnknownSession", func(t *testing.T) {
+		res, _ := poll("unknown")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+}
+
+func TestFallbackPrincipal(t *testing.T) {
+	handler := NewHandler(fallbackRouter())
+	handler.Authenticator = AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		return &Principal{ID: r.URL.Query().Get("user")}, nil
+	})
+	server := httptest.NewServer(NewFallbackHandler(handler))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "?transport=poll&user=alice")
+	require.Nil(t, err)
+	res.Body.Close()
+	id := res.Header.Get(SessionHeader)
+
+	res, err = http.Get(server.URL + "?transport=poll&user=bob&session=" + id)
+	require.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestFallbackSSEMultiline(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/pretty", func(c *Conn, m *Request) {
+		c.WriteWS([]byte("{\n  \"type\": \"pushed\"\r\n}"))
+	})
+	server := httptest.NewServer(NewFallbackHandler(NewHandler(router)))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "?transport=sse")
+	require.Nil(t, err)
+	defer res.Body.Close()
+	events := bufio.NewReader(res.Body)
+	_, id := readEvent(t, events)
+
+	m, _ := NewRequest("GET", "/pretty", nil)
+	postFallback(t, server.URL, id, m)
+
+	//Every line of frame is own data field
+	_, data := readEvent(t, events)
+	assert.Equal(t, "{\n  \"type\": \"pushed\"\n}", data)
+}
@@ -1,12 +1,19 @@
 module wsrest
 
-go 1.13
+go 1.21
+
+require (
+	github.com/gorilla/websocket v1.4.2
+	github.com/satori/go.uuid v1.2.0
+	github.com/sirupsen/logrus v1.6.0
+	github.com/stretchr/testify v1.6.0
+)
 
 require (
 	github.com/btcsuite/btcutil v1.0.2 // indirect
 	github.com/creack/pty v1.1.11 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/protobuf v1.4.2 // indirect
-	github.com/gorilla/websocket v1.4.2
 	github.com/kr/pty v1.1.8 // indirect
 	github.com/lucas-clemente/quic-go v0.16.0 // indirect
 	github.com/maxmcd/webtty v0.3.0 // indirect
@@ -14,11 +21,10 @@ require (
 	github.com/pion/srtp v1.3.4 // indirect
 	github.com/pion/stun v0.3.5 // indirect
 	github.com/pion/webrtc/v2 v2.2.14 // indirect
-	github.com/satori/go.uuid v1.2.0
-	github.com/sirupsen/logrus v1.6.0
-	github.com/stretchr/testify v1.6.0
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/crypto v0.0.0-20200510223506-06a226fb4e37 // indirect
 	golang.org/x/net v0.0.0-20200528225125-3c3fba18258b // indirect
 	golang.org/x/sys v0.0.0-20200523222454-059865788121 // indirect
 	google.golang.org/protobuf v1.24.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
@@ -0,0 +1,184 @@
+package wsrest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"wsrest/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+// Handler is http.Handler that serves router over websocket or REST
+// depending if request is asking for upgrade.
+type Handler struct {
+	Router        Router
+	Authenticator Authenticator
+	Upgrade       UpgradeOptions
+	RateLimit     RateLimitOptions
+	PanicHandler  PanicHandlerFn
+	Dispatch      DispatchMode
+	DispatchKey   DispatchKeyFn
+	// Lifecycle hooks added to every connection
+	OnOpen  ConnOpenHandlerFn
+	OnClose ConnClosedHandlerFn
+	OnError ConnErrorHandlerFn
+	// Logger is used by every connection. Default is logrus standard logger
+	Logger logger.Logger
+	// Sessions enables websocket session resumption
+	Sessions *SessionManager
+
+	once             sync.Once
+	upgrader         *websocket.Upgrader
+	principalLimiter *RateLimiter
+	restLimiter      *RateLimiter
+}
+
+func NewHandler(router Router) *Handler {
+	return &Handler{
+		Router: router,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.ServeWS(w, r)
+		return
+	}
+	h.ServeRest(w, r)
+}
+
+func (h *Handler) ServeWS(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.Authenticator)
+	if !ok {
+		return
+	}
+
+	h.init()
+	header := h.Upgrade.Header
+	var session *Session
+	var replay [][]byte
+	var resumed bool
+	if h.Sessions != nil {
+		session, replay, resumed = h.Sessions.open(r, principal)
+		header = header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set(SessionHeader, session.ID)
+		header.Set(SessionResumedHeader, strconv.FormatBool(resumed))
+	}
+
+	wsc, err := NewConnWSUpgrader(w, r, h.Router, h.upgrader, header)
+	if err != nil {
+		//Upgrader already responded with error
+		if session != nil && !resumed {
+			h.Sessions.remove(session)
+		}
+		return
+	}
+	wsc.SetPrincipal(principal)
+	if session != nil {
+		h.Sessions.attach(session, wsc, replay)
+	}
+	release := h.setupConn(wsc)
+	defer release()
+	wsc.HandleWSConnection()
+}
+
+func (h *Handler) ServeRest(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authenticate(w, r, h.Authenticator)
+	if !ok {
+		return
+	}
+
+	wsc, err := NewConnRest(w, r, h.Router)
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, SimpleMsg(err.Error()))
+		return
+	}
+	wsc.SetPrincipal(principal)
+	release := h.setupConn(wsc)
+	defer release()
+	wsc.HandleRestConnection()
+}
+
+func (h *Handler) init() {
+	h.once.Do(func() {
+		h.upgrader = h.Upgrade.upgrader()
+		h.principalLimiter = NewRateLimiter(h.RateLimit.Principal)
+		h.restLimiter = NewRateLimiter(h.RateLimit.Conn)
+	})
+}
+
+// setupConn applies handler settings on new connection. Returned function must be called once connection is done
+func (h *Handler) setupConn(wsc *Conn) (release func()) {
+	h.init()
+	if h.Logger != nil {
+		wsc.SetLogger(h.Logger)
+	}
+	wsc.PanicHandler = h.PanicHandler
+	wsc.SetDispatchMode(h.Dispatch, h.DispatchKey)
+	if h.OnOpen != nil {
+		wsc.OnOpen(h.OnOpen)
+	}
+	if h.OnClose != nil {
+		wsc.OnClose(h.OnClose)
+	}
+	if h.OnError != nil {
+		wsc.OnError(h.OnError)
+	}
+	wsc.limits.maxViolations = int32(h.RateLimit.MaxViolations)
+
+	principal, ok := wsc.Principal()
+	releaseShared := func() {}
+	if _, rest := wsc.T.(ResponseTransport); rest {
+		//Connection and route limits of REST are shared by principal, or by remote address if not authenticated
+		key := "addr " + remoteHost(wsc.GetRemoteAddr())
+		if ok {
+			key = "principal " + principal.ID
+		}
+
+		wsc.Lock()
+		wsc.limits.mutex.Lock()
+		wsc.limits.shared = h.restLimiter
+		wsc.limits.sharedKey = key
+		if h.RateLimit.Conn.enabled() {
+			wsc.limits.conn = wsc.limits.acquire("conn", h.RateLimit.Conn)
+		}
+		wsc.limits.mutex.Unlock()
+		wsc.Unlock()
+		releaseShared = wsc.limits.release
+	} else {
+		wsc.SetRateLimit(h.RateLimit.Conn)
+	}
+
+	if !ok || !h.RateLimit.Principal.enabled() {
+		return releaseShared
+	}
+
+	wsc.Lock()
+	wsc.limits.principal = h.principalLimiter.acquire(principal.ID)
+	wsc.Unlock()
+	return func() {
+		releaseShared()
+		h.principalLimiter.release(principal.ID)
+	}
+}
+
+// remoteHost returns host of remote address without port
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func writeHTTPError(w http.ResponseWriter, code int, v interface{}) {
+	data, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
@@ -0,0 +1,177 @@
+package wsrest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"wsrest/logger"
+	"wsrest/tracing"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithHTTPFallback makes Dial use plain HTTP requests when websocket upgrade fails, see DialHTTP.
+// Fallback is not used when server is not reachable
+func WithHTTPFallback() DialOption {
+	return func(c *Client) {
+		c.httpFallback = true
+	}
+}
+
+// DialHTTP creates client sending every request as HTTP request to server handling REST, see Conn.HandleRestConnection.
+// Request resource is appended to base url, and envelope headers and headers from WithHeader are sent as HTTP headers.
+// Server can not push events, so subscriptions are not supported.
+// Request is sent within request context, and failure without HTTP response is returned as error wrapping ErrConnectionLost
+func DialHTTP(baseurl string, opts ...DialOption) (*Client, error) {
+	c := newClient(opts)
+	c.log = c.log.WithFields(logger.Fields{"url": baseurl})
+
+	t, err := c.httpTransport(baseurl)
+	if err != nil {
+		return c, err
+	}
+
+	c.start(t, nil)
+	return c, nil
+}
+
+// HTTPMode reports if client sends requests over plain HTTP
+func (c *Client) HTTPMode() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	_, ok := c.conn.(*httpClientTransport)
+	return ok
+}
+
+// fallbackable reports if failed dial can be retried over HTTP. Server must be reachable
+func fallbackable(err error) bool {
+	var operr *net.OpError
+	if errors.As(err, &operr) && operr.Op == "dial" {
+		return false
+	}
+	return true
+}
+
+// httpTransport creates HTTP transport for base url, where ws scheme is replaced with http
+func (c *Client) httpTransport(baseurl string) (*httpClientTransport, error) {
+	u, err := url.Parse(baseurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	ht := &http.Transport{
+		Proxy:           c.dialer.Proxy,
+		TLSClientConfig: c.dialer.TLSClientConfig,
+	}
+	if c.netDial != nil {
+		ht.DialContext = c.netDial
+	}
+
+	return &httpClientTransport{
+		base:   u,
+		client: &http.Client{Transport: ht},
+		header: c.header.Clone(),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// roundTripper is transport sending request and returning its response directly, without frames
+type roundTripper interface {
+	RoundTrip(ctx context.Context, m *Request) (*Request, error)
+}
+
+// httpClientTransport sends every request as HTTP request within request context. It does not carry frames
+type httpClientTransport struct {
+	base   *url.URL
+	client *http.Client
+	header http.Header
+	done   chan struct{}
+	once   sync.Once
+}
+
+// ReadFrame blocks until transport is closed, as server can not push frames
+func (t *httpClientTransport) ReadFrame() ([]byte, error) {
+	<-t.done
+	return nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}
+}
+
+func (t *httpClientTransport) WriteFrame(data []byte) error {
+	return fmt.Errorf("HTTP transport does not support frames")
+}
+
+// RoundTrip sends request. Failure without HTTP response is returned wrapping ErrConnectionLost
+func (t *httpClientTransport) RoundTrip(ctx context.Context, m *Request) (*Request, error) {
+	select {
+	case <-t.done:
+		return nil, ErrNoConnection
+	default:
+	}
+
+	body := bytes.NewReader(m.GetData())
+	r, err := http.NewRequestWithContext(ctx, m.GetMethod(), t.base.String()+m.GetResource(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header = t.header.Clone()
+	for k, v := range m.Header {
+		r.Header.Set(k, v)
+	}
+	if body.Len() > 0 {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if m.TraceParent != "" {
+		r.Header.Set(tracing.Header, m.TraceParent)
+	}
+
+	resp, err := t.client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnectionLost, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnectionLost, err)
+	}
+
+	res := &Request{UID: m.GetUID(), Method: m.GetMethod(), Resource: m.GetResource(), Code: resp.StatusCode}
+	if len(data) > 0 {
+		if !json.Valid(data) {
+			data, _ = json.Marshal(string(data))
+		}
+		res.SetData(data)
+	}
+	return res, nil
+}
+
+func (t *httpClientTransport) Close(code int, reason string) error {
+	t.once.Do(func() {
+		close(t.done)
+		t.client.CloseIdleConnections()
+	})
+	return nil
+}
+
+func (t *httpClientTransport) RemoteAddr() string {
+	return t.base.Host
+}
+
+func (t *httpClientTransport) Name() string {
+	return "http"
+}
@@ -0,0 +1,151 @@
+package wsrest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// restOnlyServer rejects websocket upgrades, like proxy blocking them
+func restOnlyServer() *httptest.Server {
+	router := NewRouter()
+	router.HandleFunc("/echo", func(c *Conn, m *Request) {
+		data := map[string]interface{}{}
+		json.Unmarshal(m.GetData(), &data)
+		data["token"] = m.GetHeader("X-Token")
+		data["key"] = m.GetHeader(IdempotencyKeyHeader)
+		data["id"] = m.GetParams()["id"]
+		c.Respond(m, data, http.StatusOK)
+	})
+	router.HandleFunc("/sleep", func(c *Conn, m *Request) {
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-m.Context().Done():
+		}
+		c.Respond(m, SimpleMsg("done"), http.StatusOK)
+	})
+
+	h := NewHandler(router)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			http.Error(w, "upgrade blocked", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+}
+
+func TestDialHTTP(t *testing.T) {
+	server := restOnlyServer()
+	defer server.Close()
+
+	c, err := DialHTTP(server.URL, WithHeader("X-Token", "secret"))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.True(t, c.HTTPMode())
+
+	m, err := NewRequest("POST", "/echo?id=7", map[string]string{"name": "john"})
+	require.NoError(t, err)
+	m.SetHeader(IdempotencyKeyHeader, "k1")
+	res, err := c.Do(m)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.GetCode())
+	assert.Equal(t, m.GetUID(), res.GetUID())
+
+	out := map[string]string{}
+	require.NoError(t, c.PostInto(context.Background(), "/echo", map[string]string{"name": "jane"}, &out))
+	assert.Equal(t, "jane", out["name"])
+	assert.Equal(t, "secret", out["token"])
+
+	out = map[string]string{}
+	require.NoError(t, c.DoInto(context.Background(), m, &out))
+	assert.Equal(t, map[string]string{"name": "john", "token": "secret", "key": "k1", "id": "7"}, out)
+
+	err = c.GetInto(context.Background(), "/missing", nil)
+	serr, ok := err.(*StatusError)
+	require.True(t, ok, "err=%v", err)
+	assert.Equal(t, http.StatusNotFound, serr.Code)
+
+	_, err = c.Subscribe(context.Background(), "users")
+	assert.Error(t, err)
+}
+
+func TestDialHTTPFallback(t *testing.T) {
+	server := restOnlyServer()
+	defer server.Close()
+	wsurl := strings.Replace(server.URL, "http", "ws", 1)
+
+	_, err := Dial(wsurl, nil)
+	require.Error(t, err)
+
+	c, err := Dial(wsurl, nil, WithHTTPFallback())
+	require.NoError(t, err)
+	defer c.Close()
+	assert.True(t, c.HTTPMode())
+
+	res, err := c.Post("/echo", `{"name":"john"}`)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.GetCode())
+
+	//Unreachable server is not fallen back to HTTP
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	_, err = Dial("ws://"+addr, nil, WithHTTPFallback())
+	assert.Error(t, err)
+}
+
+func TestDialHTTPContext(t *testing.T) {
+	server := restOnlyServer()
+	defer server.Close()
+
+	c, err := DialHTTP(server.URL)
+	require.NoError(t, err)
+	defer c.Close()
+	c.RequestTimeout = 200 * time.Millisecond
+
+	//Deadline of call is used instead of RequestTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res, err := c.GetContext(ctx, "/sleep", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.GetCode())
+
+	_, err = c.Get("/sleep", nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "err=%v", err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = c.GetContext(ctx, "/sleep", nil)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestDialHTTPUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	c, err := DialHTTP("http://" + addr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	res, err := c.Get("/echo", nil)
+	assert.Nil(t, res)
+	assert.True(t, errors.Is(err, ErrConnectionLost), "err=%v", err)
+
+	err = c.GetInto(context.Background(), "/echo", nil)
+	_, isStatus := err.(*StatusError)
+	assert.False(t, isStatus)
+}
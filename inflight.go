@@ -0,0 +1,100 @@
+package wsrest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrTooManyInFlight is returned when in-flight limit is reached with InFlightFail policy
+var ErrTooManyInFlight = errors.New("Too many requests in flight")
+
+// InFlightPolicy decides what happens with request over in-flight limit
+type InFlightPolicy int
+
+const (
+	// InFlightWait waits for free slot until request context is done
+	InFlightWait InFlightPolicy = iota
+	// InFlightFail fails request with ErrTooManyInFlight
+	InFlightFail
+)
+
+// ClientStats are request counters of client. Every retried attempt is counted
+type ClientStats struct {
+	// InFlight are requests sent and waiting for response
+	InFlight int64
+	// Waiting are requests waiting for in-flight slot
+	Waiting int64
+	// Completed are requests which got response
+	Completed uint64
+	// Failed are requests which failed with error, including rejected ones
+	Failed uint64
+}
+
+type clientStats struct {
+	inflight  int64
+	waiting   int64
+	completed uint64
+	failed    uint64
+}
+
+// WithMaxInFlight limits number of requests waiting for response. Limit 1 disables pipelining of requests
+func WithMaxInFlight(n int, policy InFlightPolicy) DialOption {
+	return func(c *Client) {
+		if n <= 0 {
+			c.inflight = nil
+			return
+		}
+		c.inflight = make(chan struct{}, n)
+		c.inflightPolicy = policy
+	}
+}
+
+// Stats returns request counters
+func (c *Client) Stats() ClientStats {
+	return ClientStats{
+		InFlight:  atomic.LoadInt64(&c.stats.inflight),
+		Waiting:   atomic.LoadInt64(&c.stats.waiting),
+		Completed: atomic.LoadUint64(&c.stats.completed),
+		Failed:    atomic.LoadUint64(&c.stats.failed),
+	}
+}
+
+// acquire takes in-flight slot. Returned function releases it
+func (c *Client) acquire(ctx context.Context) (release func(), err error) {
+	if c.inflight == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case c.inflight <- struct{}{}:
+		return func() { <-c.inflight }, nil
+	default:
+	}
+
+	if c.inflightPolicy == InFlightFail {
+		return nil, ErrTooManyInFlight
+	}
+
+	atomic.AddInt64(&c.stats.waiting, 1)
+	defer atomic.AddInt64(&c.stats.waiting, -1)
+	select {
+	case c.inflight <- struct{}{}:
+		return func() { <-c.inflight }, nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("Timeout occured: %w", ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// observe counts finished request
+func (c *Client) observe(err error) {
+	if err != nil {
+		atomic.AddUint64(&c.stats.failed, 1)
+		return
+	}
+	atomic.AddUint64(&c.stats.completed, 1)
+}
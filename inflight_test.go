@@ -0,0 +1,76 @@
+package wsrest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func slowRouter(release chan struct{}) *FastRouter {
+	router := NewRouter()
+	router.HandleFunc("/slow", func(c *Conn, m *Request) {
+		<-release
+		c.Respond(m, SimpleMsg("done"), http.StatusOK)
+	}).Dispatch(DispatchConcurrent, nil)
+	return router
+}
+
+func TestClientMaxInFlightFail(t *testing.T) {
+	release := make(chan struct{})
+	c := pipeClient(t, slowRouter(release), WithMaxInFlight(2, InFlightFail))
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := c.Get("/slow", nil)
+			errs <- err
+		}()
+	}
+	assert.Eventually(t, func() bool { return c.Stats().InFlight == 2 }, time.Second, 5*time.Millisecond)
+
+	_, err := c.Get("/slow", nil)
+	assert.Equal(t, ErrTooManyInFlight, err)
+	assert.Equal(t, uint64(1), c.Stats().Failed)
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, <-errs)
+	}
+	assert.Equal(t, ClientStats{Completed: 2, Failed: 1}, c.Stats())
+}
+
+func TestClientMaxInFlightWait(t *testing.T) {
+	release := make(chan struct{})
+	c := pipeClient(t, slowRouter(release), WithMaxInFlight(1, InFlightWait))
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := c.Get("/slow", nil)
+		errs <- err
+	}()
+	assert.Eventually(t, func() bool { return c.Stats().InFlight == 1 }, time.Second, 5*time.Millisecond)
+
+	//Waiting respects context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.GetContext(ctx, "/slow", nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "err=%v", err)
+
+	go func() {
+		_, err := c.Get("/slow", nil)
+		errs <- err
+	}()
+	assert.Eventually(t, func() bool { return c.Stats().Waiting == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(1), c.Stats().InFlight)
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, <-errs)
+	}
+	assert.Equal(t, ClientStats{Completed: 2, Failed: 1}, c.Stats())
+}
@@ -0,0 +1,33 @@
+package wsrest
+
+import "context"
+
+// Invoker sends request and returns response
+type Invoker func(ctx context.Context, m *Request) (*Request, error)
+
+// Interceptor wraps every Client request. It can change request, response or error, and must call next to send request.
+// Calling next multiple times resends request, for example on retry
+type Interceptor func(ctx context.Context, m *Request, next Invoker) (*Request, error)
+
+// WithInterceptors adds interceptors to client. First interceptor is outermost
+func WithInterceptors(interceptors ...Interceptor) DialOption {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// Use adds interceptors to client. It must not be called concurrently with requests
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.interceptors = append(c.interceptors, interceptors...)
+}
+
+// chain builds invoker running interceptors around invoker
+func chain(interceptors []Interceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, m *Request) (*Request, error) {
+			return interceptor(ctx, m, next)
+		}
+	}
+	return invoker
+}
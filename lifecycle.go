@@ -0,0 +1,146 @@
+package wsrest
+
+import (
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConnState is state of connection. It is safe to read concurrently with Conn.State
+type ConnState int32
+
+const (
+	StateConnecting ConnState = iota
+	StateOpen
+	StateClosing
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateOpen:
+		return "open"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// CloseInfo describes why connection is closed. Code is websocket close code.
+// Err is set when connection is not closed normally
+type CloseInfo struct {
+	Code   int
+	Reason string
+	Err    error
+}
+
+type ConnOpenHandlerFn func(wsc *Conn)
+type ConnClosedHandlerFn func(wsc *Conn, info CloseInfo)
+type ConnErrorHandlerFn func(wsc *Conn, err error)
+
+// connHooks are lifecycle hooks of connection
+type connHooks struct {
+	open   []ConnOpenHandlerFn
+	closed []ConnClosedHandlerFn
+	errors []ConnErrorHandlerFn
+}
+
+// OnOpen is called when connection starts to be handled
+func (wsc *Conn) OnOpen(fn ConnOpenHandlerFn) {
+	wsc.Lock()
+	defer wsc.Unlock()
+	wsc.hooks.open = append(wsc.hooks.open, fn)
+}
+
+// OnClose is called once connection is closed, with close code, reason and error
+func (wsc *Conn) OnClose(fn ConnClosedHandlerFn) {
+	wsc.Lock()
+	defer wsc.Unlock()
+	wsc.hooks.closed = append(wsc.hooks.closed, fn)
+}
+
+// OnError is called on transport errors and for requests that can not be decoded
+func (wsc *Conn) OnError(fn ConnErrorHandlerFn) {
+	wsc.Lock()
+	defer wsc.Unlock()
+	wsc.hooks.errors = append(wsc.hooks.errors, fn)
+}
+
+func (wsc *Conn) State() ConnState {
+	return ConnState(atomic.LoadInt32(&wsc.state))
+}
+
+func (wsc *Conn) setState(from ConnState, to ConnState) bool {
+	return atomic.CompareAndSwapInt32(&wsc.state, int32(from), int32(to))
+}
+
+func (wsc *Conn) open() {
+	if !wsc.setState(StateConnecting, StateOpen) {
+		return
+	}
+	wsc.Lock()
+	wsc.opened = true
+	wsc.Unlock()
+	metricConnections.Inc(wsc.transportName())
+
+	wsc.RLock()
+	hooks := wsc.hooks.open
+	wsc.RUnlock()
+	for _, fn := range hooks {
+		fn(wsc)
+	}
+}
+
+func (wsc *Conn) notifyError(err error) {
+	wsc.RLock()
+	hooks := wsc.hooks.errors
+	wsc.RUnlock()
+	for _, fn := range hooks {
+		fn(wsc, err)
+	}
+}
+
+// finish moves connection to closed state and runs close handlers. Only first call has effect
+func (wsc *Conn) finish(info CloseInfo) {
+	wsc.Lock()
+	if wsc.Closed {
+		wsc.Unlock()
+		return
+	}
+	wsc.Closed = true
+	if wsc.closeInfo != nil {
+		//Close was requested by us
+		info = *wsc.closeInfo
+	}
+	hooks := wsc.hooks.closed
+	opened := wsc.opened
+	wsc.Unlock()
+	wsc.queue.close()
+
+	if opened {
+		metricConnections.Dec(wsc.transportName())
+	}
+
+	atomic.StoreInt32(&wsc.state, int32(StateClosed))
+	for _, fn := range hooks {
+		fn(wsc, info)
+	}
+	wsc.RunCloseHandlers()
+	wsc.Log.Infof("Connection is closed code=%d reason=%s err=%v", info.Code, info.Reason, info.Err)
+}
+
+// readCloseInfo converts read error to close info
+func readCloseInfo(err error) CloseInfo {
+	if cerr, ok := err.(*websocket.CloseError); ok {
+		info := CloseInfo{Code: cerr.Code, Reason: cerr.Text}
+		if cerr.Code != websocket.CloseNormalClosure && cerr.Code != websocket.CloseGoingAway {
+			info.Err = err
+		}
+		return info
+	}
+	return CloseInfo{Code: websocket.CloseAbnormalClosure, Err: err}
+}
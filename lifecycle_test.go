@@ -0,0 +1,162 @@
+package wsrest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnCloseRest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	wsc, err := NewConnRest(httptest.NewRecorder(), r, NewRouter())
+	require.Nil(t, err)
+
+	closed := 0
+	wsc.OnClose(func(c *Conn, info CloseInfo) {
+		closed++
+		assert.Equal(t, websocket.CloseGoingAway, info.Code)
+	})
+
+	assert.Equal(t, StateConnecting, wsc.State())
+	wsc.Close(websocket.CloseGoingAway, "shutdown")
+	wsc.Close(websocket.CloseNormalClosure, "")
+	assert.Equal(t, StateClosed, wsc.State())
+	assert.Equal(t, 1, closed)
+}
+
+func TestConnLifecycleWebsocket(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/bye", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("bye"), http.StatusOK)
+		c.Close(4000, "bye bye")
+	})
+
+	opened := make(chan ConnState, 1)
+	closed := make(chan CloseInfo, 1)
+	h := NewHandler(router)
+	h.OnOpen = func(c *Conn) { opened <- c.State() }
+	h.OnClose = func(c *Conn, info CloseInfo) { closed <- info }
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+	domain := strings.Replace(server.URL, "http", "ws", 1)
+
+	t.Run("ServerClose", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(domain, nil)
+		require.Nil(t, err)
+		defer conn.Close()
+		assert.Equal(t, StateOpen, <-opened)
+
+		m, _ := NewRequest("GET", "/bye", nil)
+		require.Nil(t, conn.WriteJSON(m))
+
+		res := &Request{}
+		require.Nil(t, conn.ReadJSON(res))
+		assert.Equal(t, http.StatusOK, res.Code)
+
+		_, _, err = conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, 4000), "%v", err)
+
+		info := <-closed
+		assert.Equal(t, 4000, info.Code)
+		assert.Equal(t, "bye bye", info.Reason)
+		assert.Nil(t, info.Err)
+	})
+
+	t.Run("ClientClose", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(domain, nil)
+		require.Nil(t, err)
+		<-opened
+
+		msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "leaving")
+		require.Nil(t, conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)))
+		conn.Close()
+
+		info := <-closed
+		assert.Equal(t, websocket.CloseGoingAway, info.Code)
+		assert.Equal(t, "leaving", info.Reason)
+		assert.Nil(t, info.Err)
+	})
+
+	t.Run("AbnormalClose", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(domain, nil)
+		require.Nil(t, err)
+		<-opened
+		conn.Close()
+
+		info := <-closed
+		assert.Equal(t, websocket.CloseAbnormalClosure, info.Code)
+		assert.NotNil(t, info.Err)
+	})
+}
+
+func TestConnWriteJSONClosing(t *testing.T) {
+	writeErr := make(chan error, 1)
+	router := NewRouter()
+	router.HandleFunc("/bye", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("bye"), http.StatusOK)
+		c.Close(websocket.CloseNormalClosure, "")
+		//Write pump is still running while closing, so frame must not be written directly
+		writeErr <- c.WriteJSON(SimpleMsg("late"))
+	})
+
+	server := httptest.NewServer(NewHandler(router))
+	defer server.Close()
+	c, err := Dial(strings.Replace(server.URL, "http", "ws", 1), nil)
+	require.Nil(t, err)
+	defer c.Close()
+
+	res, err := c.Get("/bye", nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.GetCode())
+	select {
+	case err := <-writeErr:
+		assert.NotNil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("WriteJSON blocked")
+	}
+
+	//Connection closed before it was served
+	client, _ := NewPipe()
+	wsc := NewConn(client, router)
+	wsc.Close(websocket.CloseNormalClosure, "")
+	assert.NotNil(t, wsc.WriteJSON(SimpleMsg("late")))
+}
+
+type failingWriteTransport struct {
+	*PipeTransport
+}
+
+func (t *failingWriteTransport) WriteFrame(data []byte) error {
+	return fmt.Errorf("write failed")
+}
+
+func TestConnCloseOnError(t *testing.T) {
+	client, server := NewPipe()
+	defer client.Close(websocket.CloseNormalClosure, "")
+	wsc := NewConn(&failingWriteTransport{server}, NewRouter())
+
+	opened := make(chan struct{})
+	wsc.OnOpen(func(c *Conn) { close(opened) })
+	closed := make(chan struct{})
+	wsc.OnError(func(c *Conn, err error) {
+		c.Close(websocket.CloseInternalServerErr, "write failed")
+		close(closed)
+	})
+	go wsc.Serve()
+	<-opened
+
+	go wsc.WriteJSON(SimpleMsg("fails"))
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close from error hook blocked")
+	}
+}
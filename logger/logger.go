@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Fields map[string]interface{}
+
+// Logger is leveled logger with structured fields used by Conn, Client and PubSub
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	WithFields(fields Fields) Logger
+}
+
+// Default returns logger using logrus standard logger, so application logrus configuration is respected
+func Default() Logger {
+	return NewLogrus(logrus.StandardLogger())
+}
+
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+func NewLogrus(l logrus.FieldLogger) Logger {
+	return &logrusLogger{l: l}
+}
+
+func (l *logrusLogger) Debugf(format string, args ...interface{}) { l.l.Debugf(format, args...) }
+func (l *logrusLogger) Infof(format string, args ...interface{})  { l.l.Infof(format, args...) }
+func (l *logrusLogger) Warnf(format string, args ...interface{})  { l.l.Warnf(format, args...) }
+func (l *logrusLogger) Errorf(format string, args ...interface{}) { l.l.Errorf(format, args...) }
+
+func (l *logrusLogger) WithFields(fields Fields) Logger {
+	return &logrusLogger{l: l.l.WithFields(logrus.Fields(fields))}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func NewSlog(l *slog.Logger) Logger {
+	return &slogLogger{l: l}
+}
+
+func (l *slogLogger) Debugf(format string, args ...interface{}) {
+	l.l.Debug(fmt.Sprintf(format, args...))
+}
+func (l *slogLogger) Infof(format string, args ...interface{}) {
+	l.l.Info(fmt.Sprintf(format, args...))
+}
+func (l *slogLogger) Warnf(format string, args ...interface{}) {
+	l.l.Warn(fmt.Sprintf(format, args...))
+}
+func (l *slogLogger) Errorf(format string, args ...interface{}) {
+	l.l.Error(fmt.Sprintf(format, args...))
+}
+
+func (l *slogLogger) WithFields(fields Fields) Logger {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]interface{}, 0, len(fields)*2)
+	for _, k := range keys {
+		args = append(args, k, fields[k])
+	}
+	return &slogLogger{l: l.l.With(args...)}
+}
+
+type nopLogger struct{}
+
+// Nop returns logger discarding everything
+func Nop() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Infof(format string, args ...interface{})  {}
+func (nopLogger) Warnf(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+func (n nopLogger) WithFields(fields Fields) Logger         { return n }
@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+	l := NewSlog(slog.New(h)).WithFields(Fields{"conn": "123", "remote": "127.0.0.1"})
+
+	l.Debugf("hidden")
+	l.Warnf("rate limit violations=%d", 3)
+
+	out := buf.String()
+	assert.NotContains(t, out, "hidden")
+	assert.Contains(t, out, `level=WARN msg="rate limit violations=3" conn=123 remote=127.0.0.1`)
+}
+
+func TestLogrusLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lr := logrus.New()
+	lr.SetOutput(buf)
+	lr.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+
+	l := NewLogrus(lr).WithFields(Fields{"conn": "123"})
+	l.Errorf("failed err=%s", "boom")
+
+	assert.Equal(t, "level=error msg=\"failed err=boom\" conn=123\n", buf.String())
+}
@@ -0,0 +1,60 @@
+package wsrest
+
+import (
+	"strconv"
+	"time"
+	"wsrest/metrics"
+)
+
+var (
+	metricConnections = metrics.DefaultRegistry.NewGauge("wsrest_connections_active",
+		"Number of open connections", "transport")
+	metricRequests = metrics.DefaultRegistry.NewCounter("wsrest_requests_total",
+		"Number of handled requests", "route", "method", "code")
+	metricRequestDuration = metrics.DefaultRegistry.NewHistogram("wsrest_request_duration_seconds",
+		"Route handler latency", nil, "route", "method")
+	metricSendQueue = metrics.DefaultRegistry.NewGauge("wsrest_send_queue_depth",
+		"Number of messages waiting to be written on websocket connections")
+	metricPingRTT = metrics.DefaultRegistry.NewHistogram("wsrest_ping_rtt_seconds",
+		"Websocket ping pong round trip time", nil)
+)
+
+// routeNotFound is route label for requests not matching any route
+const routeNotFound = "notfound"
+
+func (wsc *Conn) transportName() string {
+	if t, ok := wsc.T.(namedTransport); ok {
+		return t.Name()
+	}
+	return "unknown"
+}
+
+func observeRequest(route string, m *Request, start time.Time) {
+	method := methodLabel(m.GetMethod())
+	metricRequests.Inc(route, method, strconv.Itoa(m.GetCode()))
+	if !start.IsZero() {
+		metricRequestDuration.Observe(time.Since(start).Seconds(), route, method)
+	}
+}
+
+// methodLabel keeps method label bounded, as method is sent by client
+func methodLabel(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return method
+	}
+	return "other"
+}
+
+// pingPayload carries send time so round trip can be measured on pong
+func pingPayload() []byte {
+	return []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+}
+
+func observePong(payload string) {
+	sent, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return
+	}
+	metricPingRTT.Observe(time.Since(time.Unix(0, sent)).Seconds())
+}
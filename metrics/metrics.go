@@ -0,0 +1,315 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultRegistry keeps all wsrest and pubsub metrics
+var DefaultRegistry = NewRegistry()
+
+// DefaultBuckets are histogram buckets in seconds
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Handler serves DefaultRegistry in Prometheus text format
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+type collector interface {
+	name() string
+	write(w *bytes.Buffer)
+}
+
+type Registry struct {
+	mutex      sync.RWMutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.collectors[c.name()]; exists {
+		panic(fmt.Sprintf("metric %s already registered", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteTo writes all metrics in Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for n := range r.collectors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	for _, n := range names {
+		r.collectors[n].write(buf)
+	}
+	r.mutex.RUnlock()
+
+	return buf.WriteTo(w)
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// vec keeps values per label values
+type vec struct {
+	mutex  sync.Mutex
+	desc   string
+	help   string
+	kind   string
+	labels []string
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	counts []uint64 //histogram bucket counts
+	sum    float64
+}
+
+func newVec(name string, help string, kind string, labels []string) vec {
+	return vec{
+		desc:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+func (v *vec) name() string {
+	return v.desc
+}
+
+// get returns series for label values. Caller must hold lock
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d labels, got %d", v.desc, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	s, exists := v.series[key]
+	if !exists {
+		s = &series{labels: append([]string{}, values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, v.series[k])
+	}
+	return result
+}
+
+func (v *vec) header(w *bytes.Buffer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.desc, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.desc, v.kind)
+}
+
+func (v *vec) write(w *bytes.Buffer) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.header(w)
+	for _, s := range v.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", v.desc, formatLabels(v.labels, s.labels, "", ""), formatValue(s.value))
+	}
+}
+
+type Counter struct {
+	vec
+}
+
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+func (c *Counter) Add(val float64, labels ...string) {
+	c.mutex.Lock()
+	c.get(labels).value += val
+	c.mutex.Unlock()
+}
+
+func (c *Counter) Value(labels ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.get(labels).value
+}
+
+type Gauge struct {
+	vec
+}
+
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+func (g *Gauge) Set(val float64, labels ...string) {
+	g.mutex.Lock()
+	g.get(labels).value = val
+	g.mutex.Unlock()
+}
+
+func (g *Gauge) Add(val float64, labels ...string) {
+	g.mutex.Lock()
+	g.get(labels).value += val
+	g.mutex.Unlock()
+}
+
+func (g *Gauge) Inc(labels ...string) {
+	g.Add(1, labels...)
+}
+
+func (g *Gauge) Dec(labels ...string) {
+	g.Add(-1, labels...)
+}
+
+func (g *Gauge) Value(labels ...string) float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.get(labels).value
+}
+
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogram creates histogram. nil buckets means DefaultBuckets
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	h := &Histogram{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(val float64, labels ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := h.get(labels)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+
+	for i, b := range h.buckets {
+		if val <= b {
+			s.counts[i]++
+		}
+	}
+	s.value++ //count
+	s.sum += val
+}
+
+// Count returns number of observations
+func (h *Histogram) Count(labels ...string) uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return uint64(h.get(labels).value)
+}
+
+func (h *Histogram) write(w *bytes.Buffer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.header(w)
+	for _, s := range h.sorted() {
+		for i, b := range h.buckets {
+			var count uint64
+			if s.counts != nil {
+				count = s.counts[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.desc, formatLabels(h.labels, s.labels, "le", formatValue(b)), count)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %s\n", h.desc, formatLabels(h.labels, s.labels, "le", "+Inf"), formatValue(s.value))
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.desc, formatLabels(h.labels, s.labels, "", ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", h.desc, formatLabels(h.labels, s.labels, "", ""), formatValue(s.value))
+	}
+}
+
+type gaugeFunc struct {
+	vec
+	fn func() float64
+}
+
+// NewGaugeFunc registers gauge whose value is read on every export
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() float64) {
+	r.register(&gaugeFunc{vec: newVec(name, help, "gauge", nil), fn: fn})
+}
+
+func (g *gaugeFunc) write(w *bytes.Buffer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.desc, formatValue(g.fn()))
+}
+
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	parts := make([]string, 0, len(names)+1)
+	for i, n := range names {
+		parts = append(parts, n+"="+quoteLabel(values[i]))
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+"="+quoteLabel(extraValue))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// labelEscaper escapes label value as Prometheus text format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusFormat(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "Number of requests", "route", "code")
+	g := r.NewGauge("connections", "Open connections")
+	h := r.NewHistogram("latency_seconds", "Latency", []float64{0.1, 1}, "route")
+	r.NewGaugeFunc("queue", "Queue size", func() float64 { return 3 })
+
+	c.Inc("/go", "200")
+	c.Add(2, "/go", "404")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	h.Observe(0.05, "/go")
+	h.Observe(0.5, "/go")
+
+	buf := &bytes.Buffer{}
+	r.WriteTo(buf)
+
+	expected := `# HELP connections Open connections
+# TYPE connections gauge
+connections 1
+# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/go",le="0.1"} 1
+latency_seconds_bucket{route="/go",le="1"} 2
+latency_seconds_bucket{route="/go",le="+Inf"} 2
+latency_seconds_sum{route="/go"} 0.55
+latency_seconds_count{route="/go"} 2
+# HELP queue Queue size
+# TYPE queue gauge
+queue 3
+# HELP requests_total Number of requests
+# TYPE requests_total counter
+requests_total{route="/go",code="200"} 1
+requests_total{route="/go",code="404"} 2
+`
+	assert.Equal(t, expected, buf.String())
+	assert.Equal(t, float64(2), c.Value("/go", "404"))
+	assert.Equal(t, uint64(2), h.Count("/go"))
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("hits_total", "Hits").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), "hits_total 1\n")
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("hits_total", "Hits", "path").Inc("a\\b\"c\nd\té")
+
+	buf := &bytes.Buffer{}
+	r.WriteTo(buf)
+	assert.Contains(t, buf.String(), "hits_total{path=\"a\\\\b\\\"c\\nd\té\"} 1\n")
+}
@@ -0,0 +1,207 @@
+package wsrest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Frame types of NetTransport. They mirror websocket messages
+const (
+	netFrameText  byte = 1
+	netFrameClose byte = 2
+	netFramePing  byte = 3
+	netFramePong  byte = 4
+)
+
+// MaxNetFrameSize is largest frame accepted by NetTransport
+var MaxNetFrameSize uint32 = 16 << 20
+
+// NetTransport carries envelopes over TCP or unix socket. Every frame is
+// 1 byte type, 4 bytes big endian payload length and payload.
+// Close frame payload is 2 bytes close code followed by reason, same as websocket.
+type NetTransport struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	wmutex sync.Mutex
+	once   sync.Once
+	// keepAlive requires frames from peer within pongWait. Side sending pings should have it
+	keepAlive bool
+}
+
+// NewNetTransport wraps accepted connection. Connection is pinged and must answer within pong wait
+func NewNetTransport(conn net.Conn) *NetTransport {
+	return &NetTransport{conn: conn, r: bufio.NewReader(conn), keepAlive: true}
+}
+
+// newNetClientTransport wraps dialed connection, which only answers pings
+func newNetClientTransport(conn net.Conn) *NetTransport {
+	return &NetTransport{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (t *NetTransport) ReadFrame() ([]byte, error) {
+	header := make([]byte, 5)
+	for {
+		if t.keepAlive {
+			t.conn.SetReadDeadline(time.Now().Add(pongWait))
+		}
+
+		if _, err := io.ReadFull(t.r, header); err != nil {
+			return nil, err
+		}
+
+		size := binary.BigEndian.Uint32(header[1:])
+		if size > MaxNetFrameSize {
+			t.Close(websocket.CloseMessageTooBig, "frame too big")
+			return nil, fmt.Errorf("Frame size %d exceeds limit", size)
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(t.r, payload); err != nil {
+			return nil, err
+		}
+
+		switch header[0] {
+		case netFrameText:
+			return payload, nil
+		case netFramePing:
+			t.write(netFramePong, payload)
+		case netFramePong:
+			observePong(string(payload))
+		case netFrameClose:
+			cerr := &websocket.CloseError{Code: websocket.CloseNoStatusReceived}
+			if len(payload) >= 2 {
+				cerr.Code = int(binary.BigEndian.Uint16(payload))
+				cerr.Text = string(payload[2:])
+			}
+			t.Close(cerr.Code, "")
+			return nil, cerr
+		default:
+			return nil, fmt.Errorf("Unknown frame type %d", header[0])
+		}
+	}
+}
+
+func (t *NetTransport) write(typ byte, payload []byte) error {
+	t.wmutex.Lock()
+	defer t.wmutex.Unlock()
+
+	frame := make([]byte, 5+len(payload))
+	frame[0] = typ
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	copy(frame[5:], payload)
+
+	t.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	_, err := t.conn.Write(frame)
+	return err
+}
+
+func (t *NetTransport) WriteFrame(data []byte) error {
+	return t.write(netFrameText, data)
+}
+
+func (t *NetTransport) Ping() error {
+	return t.write(netFramePing, pingPayload())
+}
+
+// Close sends close frame, if not already sent, and closes connection
+func (t *NetTransport) Close(code int, reason string) error {
+	var err error
+	t.once.Do(func() {
+		payload := make([]byte, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		copy(payload[2:], reason)
+		t.write(netFrameClose, payload)
+		err = t.conn.Close()
+	})
+	return err
+}
+
+func (t *NetTransport) RemoteAddr() string {
+	return t.conn.RemoteAddr().String()
+}
+
+func (t *NetTransport) Name() string {
+	return t.conn.LocalAddr().Network()
+}
+
+// Serve accepts TCP or unix socket connections on listener and serves router over NetTransport.
+// Authenticator is called with request having only remote address of connection, as there is no HTTP request.
+// Rejected connection is closed with policy violation. Rate limits apply same as on websocket.
+// Serve returns when listener is closed.
+func (h *Handler) Serve(l net.Listener) error {
+	h.init()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if acceptRetryable(err) {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		go h.serveNet(conn)
+	}
+}
+
+// ListenAndServe listens on network "tcp" or "unix" and calls Serve
+func (h *Handler) ListenAndServe(network string, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return h.Serve(l)
+}
+
+// acceptRetryable reports if accept failed with timeout or because of running out of resources
+func acceptRetryable(err error) bool {
+	if errors.Is(err, net.ErrClosed) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+func (h *Handler) serveNet(conn net.Conn) {
+	t := NewNetTransport(conn)
+	var principal *Principal
+	if h.Authenticator != nil {
+		p, err := authenticatePrincipal(netRequest(conn), h.Authenticator)
+		if err != nil {
+			t.Close(websocket.ClosePolicyViolation, err.Error())
+			return
+		}
+		principal = p
+	}
+
+	wsc := NewConn(t, h.Router)
+	wsc.SetPrincipal(principal)
+	release := h.setupConn(wsc)
+	defer release()
+	wsc.HandleWSConnection()
+}
+
+// netRequest describes accepted connection to Authenticator
+func netRequest(conn net.Conn) *http.Request {
+	return &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: "/"},
+		Header:     http.Header{},
+		RemoteAddr: conn.RemoteAddr().String(),
+	}
+}
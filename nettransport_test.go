@@ -0,0 +1,144 @@
+package wsrest
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func netRouter() *FastRouter {
+	router := NewRouter()
+	router.HandleFunc("/echo", func(c *Conn, m *Request) {
+		c.WriteWS([]byte(`{"type":"pushed"}`))
+		c.Respond(m, SimpleMsg("echo"), http.StatusOK)
+	})
+	router.HandleFunc("/bye", func(c *Conn, m *Request) {
+		c.Close(4000, "bye")
+	})
+	return router
+}
+
+func TestNetTransport(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			addr := "127.0.0.1:0"
+			if network == "unix" {
+				addr = filepath.Join(t.TempDir(), "wsrest.sock")
+			}
+			l, err := net.Listen(network, addr)
+			require.Nil(t, err)
+			defer l.Close()
+
+			opened := make(chan string, 1)
+			h := NewHandler(netRouter())
+			h.OnOpen = func(c *Conn) { opened <- c.transportName() }
+			go h.Serve(l)
+
+			events := make(chan string, 1)
+			c, err := DialNet(network, l.Addr().String(), func(data []byte) {
+				events <- string(data)
+			})
+			require.Nil(t, err)
+			assert.Equal(t, network, <-opened)
+
+			res, err := c.Get("/echo", nil)
+			require.Nil(t, err)
+			assert.Equal(t, http.StatusOK, res.GetCode())
+			assert.Equal(t, `{"type":"pushed"}`, <-events)
+
+			closed := make(chan error, 1)
+			c.SetServerCloseHandler(func(err error) { closed <- err })
+			c.RequestTimeout = 200 * time.Millisecond
+			_, err = c.Get("/bye", nil)
+			assert.NotNil(t, err)
+
+			select {
+			case err := <-closed:
+				cerr, ok := err.(*websocket.CloseError)
+				require.True(t, ok, "expected close error, got %v", err)
+				assert.Equal(t, 4000, cerr.Code)
+				assert.Equal(t, "bye", cerr.Text)
+			case <-time.After(2 * time.Second):
+				t.Fatal("server close not received")
+			}
+		})
+	}
+}
+
+func TestNetTransportClientClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	closed := make(chan CloseInfo, 1)
+	h := NewHandler(netRouter())
+	h.OnClose = func(c *Conn, info CloseInfo) { closed <- info }
+	go h.Serve(l)
+
+	c, err := DialNet("tcp", l.Addr().String(), nil)
+	require.Nil(t, err)
+	c.Close()
+
+	info := <-closed
+	assert.Equal(t, websocket.CloseNormalClosure, info.Code)
+	assert.Nil(t, info.Err)
+}
+
+func TestNetTransportAuth(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	router := netRouter()
+	router.HandleFunc("/whoami", func(c *Conn, m *Request) {
+		p, _ := c.Principal()
+		c.Respond(m, SimpleMsg(p.ID), http.StatusOK)
+	})
+	h := NewHandler(router)
+	var rejecting int32
+	h.Authenticator = AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		if atomic.LoadInt32(&rejecting) == 1 {
+			return nil, ErrForbidden
+		}
+		return &Principal{ID: "local " + remoteHost(r.RemoteAddr)}, nil
+	})
+	h.RateLimit.Principal = RateLimit{Rate: 0.1, Burst: 1}
+	go h.Serve(l)
+
+	c, err := DialNet("tcp", l.Addr().String(), nil)
+	require.Nil(t, err)
+	defer c.Close()
+
+	res, err := c.Get("/whoami", nil)
+	require.Nil(t, err)
+	assert.Equal(t, `{"message":"local 127.0.0.1"}`, string(res.GetData()))
+
+	//Principal limit is shared with listener connections
+	res, err = c.Get("/whoami", nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, res.GetCode())
+
+	//Rejected connection is closed before serving
+	atomic.StoreInt32(&rejecting, 1)
+	rejected, err := DialNet("tcp", l.Addr().String(), nil)
+	require.Nil(t, err)
+	defer rejected.Close()
+	rejected.RequestTimeout = time.Second
+	_, err = rejected.Get("/whoami", nil)
+	assert.NotNil(t, err)
+}
+
+func TestAcceptRetryable(t *testing.T) {
+	assert.False(t, acceptRetryable(net.ErrClosed))
+	assert.True(t, acceptRetryable(&net.OpError{Op: "accept", Err: syscall.EMFILE}))
+	assert.False(t, acceptRetryable(errors.New("listener failed")))
+}
@@ -11,12 +11,19 @@ type Eventer interface {
 	SetTopicId(t string)
 }
 
+// TraceCarrier is implemented by events carrying trace context
+type TraceCarrier interface {
+	GetTraceParent() string
+	SetTraceParent(tp string)
+}
+
 type Event struct {
 	Type        string `json:"type"`
 	Application string `json:"application"`
 	Topic       string `json:"topic"`
 	TopicId     string `json:"topic_id"`
 	Timestamp   *Time  `json:"timestamp"`
+	TraceParent string `json:"traceparent,omitempty"`
 }
 
 func NewEvent(t string, Topic string, Topicid string) Event {
@@ -53,3 +60,11 @@ func (p *Event) GetTopicId() string {
 func (p *Event) SetTopicId(t string) {
 	p.TopicId = t
 }
+
+func (p *Event) GetTraceParent() string {
+	return p.TraceParent
+}
+
+func (p *Event) SetTraceParent(tp string) {
+	p.TraceParent = tp
+}
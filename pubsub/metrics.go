@@ -0,0 +1,11 @@
+package pubsub
+
+import "wsrest/metrics"
+
+// Topics are not used as label, as they are set by users and number of them is not bounded
+var (
+	metricPublished = metrics.DefaultRegistry.NewCounter("wsrest_pubsub_published_total",
+		"Number of published events")
+	metricDelivered = metrics.DefaultRegistry.NewCounter("wsrest_pubsub_delivered_total",
+		"Number of events delivered to subscribers")
+)
@@ -1,14 +1,20 @@
 package pubsub
 
 import (
+	"context"
 	"wsrest/datastream"
-
-	"github.com/sirupsen/logrus"
+	"wsrest/logger"
+	"wsrest/tracing"
 )
 
 type Option interface{}
 type OptionDoAsync struct{}
 
+// OptionLogger sets PubSub logger. Default is logrus standard logger
+type OptionLogger struct {
+	Logger logger.Logger
+}
+
 type eventSubAction struct {
 	Event
 	Subscriber *Subscriber
@@ -20,16 +26,23 @@ type PubSub struct {
 	topics      map[string][]*Subscriber
 	recv        chan Eventer
 	marshaler   datastream.Marshaler
-	log         logrus.StdLogger
+	log         logger.Logger
 }
 
-func NewPubSub() *PubSub {
+func NewPubSub(opts ...Option) *PubSub {
 	p := &PubSub{
 		recv:        make(chan Eventer, 100),
 		topics:      make(map[string][]*Subscriber),
 		subscribers: make(map[string]*Subscriber),
 		marshaler:   &datastream.JSONMarshaler{},
-		log:         logrus.New(),
+		log:         logger.Default(),
+	}
+
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case OptionLogger:
+			p.log = o.Logger
+		}
 	}
 
 	go p.listen()
@@ -71,6 +84,18 @@ func (p *PubSub) Publish(e Eventer) {
 	p.recv <- e
 }
 
+// PublishContext publishes event carrying trace context of ctx, if event is TraceCarrier
+func (p *PubSub) PublishContext(ctx context.Context, e Eventer) {
+	if tc, ok := e.(TraceCarrier); ok && tc.GetTraceParent() == "" {
+		ctx, span := tracing.Start(ctx, "publish "+e.GetTopic(), tracing.SpanKindProducer)
+		span.SetAttribute("pubsub.topic", e.GetTopic())
+		span.SetAttribute("pubsub.type", e.GetType())
+		tc.SetTraceParent(tracing.TraceParent(ctx))
+		span.End()
+	}
+	p.Publish(e)
+}
+
 func (p *PubSub) listen() {
 	for {
 		select {
@@ -99,19 +124,21 @@ func (p *PubSub) processEvent(e Eventer) {
 }
 
 func (p *PubSub) handleEvent(e Eventer) {
+	metricPublished.Inc()
 	subs := p.findTopicSubscribers(e.GetTopic())
 	if len(subs) == 0 {
-		p.log.Printf("No subscribers for topic=%s\n", e.GetTopic())
+		p.log.Debugf("No subscribers for topic=%s", e.GetTopic())
 		return
 	}
 
 	data, err := p.marshaler.Marshal(e)
 	if err != nil {
-		p.log.Printf("Fail to marshal event err=%s\n", err)
+		p.log.Errorf("Fail to marshal event err=%s", err)
 		return
 	}
 
 	p.broadcast(data, subs)
+	metricDelivered.Add(float64(len(subs)))
 }
 
 func (p *PubSub) subscribe(s *Subscriber) {
@@ -130,6 +157,11 @@ func (p *PubSub) unsubscribe(s *Subscriber) {
 				break
 			}
 		}
+		if len(topicsubs) == 0 {
+			delete(p.topics, t)
+		} else {
+			p.topics[t] = topicsubs
+		}
 	}
 	delete(p.subscribers, s.Id)
 }
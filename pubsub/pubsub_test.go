@@ -3,6 +3,7 @@ package pubsub
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -34,6 +35,27 @@ func TestSubscribtion(t *testing.T) {
 	assert.Equal(t, s.Pipe, gots.Pipe, "Subscribers not same")
 }
 
+func TestUnsubscribe(t *testing.T) {
+	p := NewPubSub()
+
+	s1 := Subscriber{Id: "s1", Topics: []string{"go", "python"}, Pipe: make(chan []byte, 3)}
+	s2 := Subscriber{Id: "s2", Topics: []string{"go"}, Pipe: make(chan []byte, 3)}
+	<-p.Subscribe(s1)
+	<-p.Subscribe(s2)
+	<-p.Unsubscribe(s1)
+
+	subs := p.findTopicSubscribers("go")
+	require.Equal(t, 1, len(subs))
+	assert.Equal(t, "s2", subs[0].Id)
+	assert.Equal(t, 0, len(p.findTopicSubscribers("python")))
+	_, exists := p.topics["python"]
+	assert.False(t, exists)
+
+	p.Publish(&Event{Type: "GoMsg", Topic: "go"})
+	<-s2.Pipe
+	assert.Equal(t, 0, len(s1.Pipe))
+}
+
 func TestPublish(t *testing.T) {
 	p := NewPubSub()
 	logrus.SetLevel(logrus.DebugLevel)
@@ -57,6 +79,7 @@ func TestPublish(t *testing.T) {
 	subs[0].Pipe <- []byte("aaa")
 	<-s.Pipe
 
+	published, delivered := metricPublished.Value(), metricDelivered.Value()
 	p.Publish(e)
 
 	//CHeck is set subscribe
@@ -65,6 +88,8 @@ func TestPublish(t *testing.T) {
 	got := &Event{}
 	json.Unmarshal(rec, got)
 	assert.Equal(t, e, got, "Event got is not same")
+	assert.Equal(t, published+1, metricPublished.Value())
+	assert.Eventually(t, func() bool { return metricDelivered.Value() == delivered+1 }, time.Second, time.Millisecond)
 }
 
 func BenchmarkPublishingProcess(t *testing.B) {
@@ -0,0 +1,229 @@
+package wsrest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"wsrest/pubsub"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	SubscribePath   = "/subscribe"
+	UnsubscribePath = "/unsubscribe"
+)
+
+// SubscribeAuthorizeFn decides if connection can subscribe topics. Returned error is responded with 403
+type SubscribeAuthorizeFn func(wsc *Conn, topics []string) error
+
+// subscribeRequest is data of subscribe and unsubscribe requests
+type subscribeRequest struct {
+	ID     string   `json:"id"`
+	Topics []string `json:"topics,omitempty"`
+}
+
+// subscriptionFrame is frame pushed to client with event of subscription
+type subscriptionFrame struct {
+	Sub   string          `json:"sub"`
+	Event json.RawMessage `json:"e"`
+}
+
+// PubSubBridge serves subscribe and unsubscribe routes, see Client.Subscribe.
+// Events of subscribed topics are pushed to connection until client unsubscribes or connection is closed.
+//
+//	bridge := wsrest.NewPubSubBridge(ps)
+//	bridge.Register(router)
+type PubSubBridge struct {
+	PubSub    *pubsub.PubSub
+	Authorize SubscribeAuthorizeFn
+	// Buffer is number of events queued for connection. Default 64.
+	// Events over it are dropped, so slow client does not block PubSub
+	Buffer int
+	// DisconnectSlow closes connection of client which does not read events fast enough, instead of dropping events
+	DisconnectSlow bool
+
+	mutex sync.Mutex
+	conns map[*Conn]map[string]*bridgeSub
+}
+
+type bridgeSub struct {
+	sub  pubsub.Subscriber
+	out  chan []byte //Events waiting to be written to connection
+	stop chan struct{}
+}
+
+func NewPubSubBridge(ps *pubsub.PubSub) *PubSubBridge {
+	return &PubSubBridge{
+		PubSub: ps,
+		Buffer: 64,
+		conns:  make(map[*Conn]map[string]*bridgeSub),
+	}
+}
+
+// Register adds subscribe and unsubscribe routes to router
+func (b *PubSubBridge) Register(r *FastRouter) {
+	r.HandleFunc(SubscribePath, b.Subscribe).Method("POST")
+	r.HandleFunc(UnsubscribePath, b.Unsubscribe).Method("POST")
+}
+
+// Subscribe is route handler subscribing connection to topics
+func (b *PubSubBridge) Subscribe(wsc *Conn, m *Request) {
+	if _, ok := wsc.T.(ResponseTransport); ok {
+		wsc.Respond(m, SimpleMsg("Subscribe requires streaming connection"), http.StatusBadRequest)
+		return
+	}
+
+	req := subscribeRequest{}
+	if err := json.Unmarshal(m.GetData(), &req); err != nil || req.ID == "" || len(req.Topics) == 0 {
+		wsc.Respond(m, SimpleMsg("Subscription id and topics are required"), http.StatusBadRequest)
+		return
+	}
+
+	if b.Authorize != nil {
+		if err := b.Authorize(wsc, req.Topics); err != nil {
+			wsc.Respond(m, SimpleMsg(err.Error()), http.StatusForbidden)
+			return
+		}
+	}
+
+	size := b.Buffer
+	if size <= 0 {
+		size = 64
+	}
+	s := &bridgeSub{
+		sub: pubsub.Subscriber{
+			Id:     wsc.ID + ":" + req.ID,
+			Topics: req.Topics,
+			Pipe:   make(chan []byte, 1),
+		},
+		out:  make(chan []byte, size),
+		stop: make(chan struct{}),
+	}
+
+	b.mutex.Lock()
+	subs, exists := b.conns[wsc]
+	if !exists {
+		subs = make(map[string]*bridgeSub)
+		b.conns[wsc] = subs
+	}
+	if _, dup := subs[req.ID]; dup {
+		b.mutex.Unlock()
+		wsc.Respond(m, SimpleMsg("Subscription %s already exists", req.ID), http.StatusConflict)
+		return
+	}
+	subs[req.ID] = s
+	b.mutex.Unlock()
+
+	if !exists {
+		wsc.OnClose(func(wsc *Conn, info CloseInfo) {
+			b.closeConn(wsc)
+		})
+	}
+
+	go b.pump(wsc, req.ID, s)
+	go b.write(wsc, req.ID, s)
+	<-b.PubSub.Subscribe(s.sub)
+	wsc.Log.Debugf("Subscribed sub=%s topics=%v", req.ID, req.Topics)
+	wsc.Respond(m, req, http.StatusOK)
+
+	if wsc.IsClosed() {
+		//Closed before close handler was added
+		b.closeConn(wsc)
+	}
+}
+
+// Unsubscribe is route handler removing subscription of connection
+func (b *PubSubBridge) Unsubscribe(wsc *Conn, m *Request) {
+	req := subscribeRequest{}
+	if err := json.Unmarshal(m.GetData(), &req); err != nil || req.ID == "" {
+		wsc.Respond(m, SimpleMsg("Subscription id is required"), http.StatusBadRequest)
+		return
+	}
+
+	b.mutex.Lock()
+	s, exists := b.conns[wsc][req.ID]
+	if exists {
+		delete(b.conns[wsc], req.ID)
+	}
+	b.mutex.Unlock()
+
+	if !exists {
+		wsc.Respond(m, SimpleMsg("Subscription %s not found", req.ID), http.StatusNotFound)
+		return
+	}
+
+	b.unsubscribe(s)
+	wsc.Log.Debugf("Unsubscribed sub=%s", req.ID)
+	wsc.Respond(m, req, http.StatusOK)
+}
+
+// Len returns number of subscriptions
+func (b *PubSubBridge) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	n := 0
+	for _, subs := range b.conns {
+		n += len(subs)
+	}
+	return n
+}
+
+func (b *PubSubBridge) closeConn(wsc *Conn) {
+	b.mutex.Lock()
+	subs := b.conns[wsc]
+	delete(b.conns, wsc)
+	b.mutex.Unlock()
+
+	for _, s := range subs {
+		b.unsubscribe(s)
+	}
+}
+
+func (b *PubSubBridge) unsubscribe(s *bridgeSub) {
+	<-b.PubSub.Unsubscribe(s.sub)
+	close(s.stop)
+}
+
+// pump moves events from subscriber pipe to connection queue. It never blocks, so PubSub is not blocked by slow client
+func (b *PubSubBridge) pump(wsc *Conn, id string, s *bridgeSub) {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case data := <-s.sub.Pipe:
+			select {
+			case s.out <- data:
+				continue
+			default:
+			}
+
+			if b.DisconnectSlow {
+				//Write pump is blocked by slow client, so queued messages can not be flushed before close
+				wsc.Log.Warnf("Client is too slow to receive events sub=%s. Disconnecting", id)
+				wsc.T.Close(websocket.ClosePolicyViolation, "slow consumer")
+				continue
+			}
+			wsc.Log.Debugf("Event queue is full, event dropped sub=%s", id)
+		}
+	}
+}
+
+// write writes queued events of subscription to connection
+func (b *PubSubBridge) write(wsc *Conn, id string, s *bridgeSub) {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case data := <-s.out:
+			frame, err := json.Marshal(subscriptionFrame{Sub: id, Event: data})
+			if err != nil {
+				wsc.Log.Errorf("Failed to marshal event sub=%s err=%s", id, err)
+				continue
+			}
+			if err := wsc.WriteWS(frame); err != nil {
+				wsc.Log.Debugf("Failed to push event sub=%s err=%s", id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package wsrest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// RateLimit is token bucket limit. Rate is number of requests per second and Burst is bucket size.
+// Zero Rate means no limit
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0
+}
+
+// RateLimitOptions configures Handler rate limits
+type RateLimitOptions struct {
+	// Conn limits every connection. REST requests, and their route limits, share buckets of principal or remote address
+	Conn RateLimit
+	// Principal limits all connections of same authenticated principal
+	Principal RateLimit
+	// MaxViolations disconnects websocket connection after this number of consecutive over limit requests. Zero disables
+	MaxViolations int
+}
+
+// RateLimitMessage is responded with 429 status code
+type RateLimitMessage struct {
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after"` //Seconds
+}
+
+type tokenBucket struct {
+	mutex  sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(l RateLimit) *tokenBucket {
+	burst := l.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		limit:  RateLimit{Rate: l.Rate, Burst: burst},
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+}
+
+// take takes token from bucket. If bucket is empty it returns duration after which token is available
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := (1 - b.tokens) / b.limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// giveBack returns taken token, when request was rejected by other bucket
+func (b *tokenBucket) giveBack() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+1)
+}
+
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(now)
+	return b.tokens >= float64(b.limit.Burst)
+}
+
+type limiterEntry struct {
+	bucket *tokenBucket
+	refs   int
+}
+
+// RateLimiter keeps token buckets shared by key, like principal ID.
+// Buckets are removed once they are not referenced and refilled.
+type RateLimiter struct {
+	mutex     sync.Mutex
+	limit     RateLimit
+	buckets   map[string]*limiterEntry
+	lastSweep time.Time
+}
+
+func NewRateLimiter(l RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limit:   l,
+		buckets: make(map[string]*limiterEntry),
+	}
+}
+
+func (l *RateLimiter) acquire(key string) *tokenBucket {
+	return l.acquireLimit(key, l.limit)
+}
+
+// acquireLimit acquires bucket with own limit, used when bucket of key is created
+func (l *RateLimiter) acquireLimit(key string, limit RateLimit) *tokenBucket {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > time.Second {
+		l.sweep(now)
+		l.lastSweep = now
+	}
+
+	e, exists := l.buckets[key]
+	if !exists {
+		e = &limiterEntry{bucket: newTokenBucket(limit)}
+		l.buckets[key] = e
+	}
+	e.refs++
+	return e.bucket
+}
+
+func (l *RateLimiter) release(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e, exists := l.buckets[key]
+	if !exists {
+		return
+	}
+
+	e.refs--
+	if e.refs <= 0 && e.bucket.full(time.Now()) {
+		delete(l.buckets, key)
+	}
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	for k, e := range l.buckets {
+		if e.refs <= 0 && e.bucket.full(now) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+func (l *RateLimiter) len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.buckets)
+}
+
+// connLimits is rate limiting state of single Conn
+type connLimits struct {
+	mutex         sync.Mutex
+	conn          *tokenBucket
+	principal     *tokenBucket
+	routes        map[*Route]*tokenBucket
+	violations    int32
+	maxViolations int32
+	// REST requests have new Conn every time, so their buckets are shared in limiter by key
+	shared    *RateLimiter
+	sharedKey string
+	acquired  []string
+}
+
+// acquire acquires shared bucket of key. Must be called under lock
+func (l *connLimits) acquire(key string, limit RateLimit) *tokenBucket {
+	key = l.sharedKey + " " + key
+	l.acquired = append(l.acquired, key)
+	return l.shared.acquireLimit(key, limit)
+}
+
+// release releases shared buckets
+func (l *connLimits) release() {
+	l.mutex.Lock()
+	acquired := l.acquired
+	l.acquired = nil
+	l.mutex.Unlock()
+
+	for _, key := range acquired {
+		l.shared.release(key)
+	}
+}
+
+func (l *connLimits) routeBucket(r *Route) *tokenBucket {
+	if !r.rateLimit.enabled() {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.routes == nil {
+		l.routes = make(map[*Route]*tokenBucket)
+	}
+
+	b, exists := l.routes[r]
+	if !exists {
+		if l.shared != nil {
+			b = l.acquire(fmt.Sprintf("route %p", r), r.rateLimit)
+		} else {
+			b = newTokenBucket(r.rateLimit)
+		}
+		l.routes[r] = b
+	}
+	return b
+}
+
+// takeAll takes token from every bucket. If any is empty, tokens taken from others are given back
+// and wait of empty bucket is returned
+func takeAll(buckets []*tokenBucket, now time.Time) (bool, time.Duration) {
+	for i, b := range buckets {
+		if b == nil {
+			continue
+		}
+
+		if ok, wait := b.take(now); !ok {
+			for _, taken := range buckets[:i] {
+				if taken != nil {
+					taken.giveBack()
+				}
+			}
+			return false, wait
+		}
+	}
+	return true, 0
+}
+
+// SetRateLimit limits requests on this connection
+func (wsc *Conn) SetRateLimit(l RateLimit) {
+	wsc.Lock()
+	defer wsc.Unlock()
+	wsc.limits.conn = nil
+	if l.enabled() {
+		wsc.limits.conn = newTokenBucket(l)
+	}
+}
+
+// allow checks connection, principal and route limits. It responds with 429 if request is over limit
+func (wsc *Conn) allow(route *Route, m *Request) bool {
+	wsc.RLock()
+	buckets := []*tokenBucket{wsc.limits.conn, wsc.limits.principal, wsc.limits.routeBucket(route)}
+	wsc.RUnlock()
+
+	ok, retry := takeAll(buckets, time.Now())
+	if ok {
+		atomic.StoreInt32(&wsc.limits.violations, 0)
+		return true
+	}
+
+	wsc.setHeader("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+
+	wsc.Respond(m, RateLimitMessage{
+		Message:    "Too many requests",
+		RetryAfter: retry.Seconds(),
+	}, http.StatusTooManyRequests)
+
+	violations := atomic.AddInt32(&wsc.limits.violations, 1)
+	_, rest := wsc.T.(ResponseTransport)
+	if max := wsc.limits.maxViolations; max > 0 && violations >= max && !rest {
+		wsc.Log.Warnf("Too many rate limit violations=%d. Disconnecting", violations)
+		wsc.Close(websocket.ClosePolicyViolation, "rate limit exceeded")
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package wsrest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 2})
+	now := time.Now()
+
+	ok, _ := b.take(now)
+	assert.True(t, ok)
+	ok, _ = b.take(now)
+	assert.True(t, ok)
+
+	ok, wait := b.take(now)
+	assert.False(t, ok)
+	assert.Equal(t, 100*time.Millisecond, wait)
+
+	ok, _ = b.take(now.Add(wait))
+	assert.True(t, ok)
+}
+
+func TestTakeAllZeroWait(t *testing.T) {
+	now := time.Now()
+	conn := newTokenBucket(RateLimit{Rate: 10, Burst: 1})
+	//Wait of empty fast bucket rounds to zero, which must still reject
+	fast := newTokenBucket(RateLimit{Rate: 1e12, Burst: 1})
+	fast.take(now)
+
+	ok, wait := takeAll([]*tokenBucket{conn, nil, fast}, now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Duration(0), wait)
+	//Token of connection bucket is given back
+	assert.True(t, conn.full(now))
+}
+
+func TestRateLimiterCleanup(t *testing.T) {
+	l := NewRateLimiter(RateLimit{Rate: 1000, Burst: 1})
+	b := l.acquire("john")
+	assert.Equal(t, b, l.acquire("john"))
+	b.take(time.Now())
+
+	l.release("john")
+	l.release("john")
+	time.Sleep(5 * time.Millisecond)
+	l.sweep(time.Now())
+	assert.Equal(t, 0, l.len())
+}
+
+func TestRateLimitRest(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/limited", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	})
+
+	h := NewHandler(router)
+	h.Authenticator = AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		return &Principal{ID: "john"}, nil
+	})
+	h.RateLimit.Principal = RateLimit{Rate: 0.1, Burst: 2}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	codes := []int{}
+	var resp *http.Response
+	for i := 0; i < 3; i++ {
+		var err error
+		resp, err = http.Get(server.URL + "/limited")
+		require.Nil(t, err)
+		codes = append(codes, resp.StatusCode)
+		if i < 2 {
+			resp.Body.Close()
+		}
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+	assert.Equal(t, "10", resp.Header.Get("Retry-After"))
+
+	msg := RateLimitMessage{}
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&msg))
+	assert.InDelta(t, 10, msg.RetryAfter, 0.1)
+}
+
+func restCodes(t *testing.T, url string, n int) []int {
+	codes := []int{}
+	for i := 0; i < n; i++ {
+		resp, err := http.Get(url)
+		require.Nil(t, err)
+		resp.Body.Close()
+		codes = append(codes, resp.StatusCode)
+	}
+	return codes
+}
+
+func TestRateLimitRestShared(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/route", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	}).RateLimit(0.1, 1)
+	router.HandleFunc("/conn", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	})
+
+	h := NewHandler(router)
+	h.RateLimit.Conn = RateLimit{Rate: 0.1, Burst: 3}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	//Anonymous requests are limited by remote address
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests}, restCodes(t, server.URL+"/route", 2))
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, restCodes(t, server.URL+"/conn", 3))
+}
+
+func TestRateLimitRejectedKeepsTokens(t *testing.T) {
+	router := NewRouter()
+	route := router.HandleFunc("/route", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	}).RateLimit(0.1, 1)
+
+	wsc := NewConn(NewHTTPTransport(httptest.NewRecorder(), httptest.NewRequest("GET", "/route", nil)), router)
+	wsc.SetRateLimit(RateLimit{Rate: 0.1, Burst: 5})
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if wsc.allow(route, &Request{Method: "GET", Resource: "/route"}) {
+			allowed++
+		}
+	}
+	assert.Equal(t, 1, allowed)
+	//Only allowed request took token of connection
+	assert.InDelta(t, 4, wsc.limits.conn.tokens, 0.01)
+}
+
+func TestRateLimitWebsocketDisconnect(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/limited", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	}).RateLimit(0.1, 1)
+
+	h := NewHandler(router)
+	h.RateLimit.MaxViolations = 2
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(server.URL, "http", "ws", 1), nil)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	expected := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	for _, code := range expected {
+		m, err := NewRequest("GET", "/limited", nil)
+		require.Nil(t, err)
+		require.Nil(t, conn.WriteJSON(m))
+
+		res := &Request{}
+		require.Nil(t, conn.ReadJSON(res))
+		assert.Equal(t, code, res.Code)
+	}
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "%v", err)
+}
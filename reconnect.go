@@ -0,0 +1,197 @@
+package wsrest
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrConnectionLost is returned for request pending when connection is lost
+var ErrConnectionLost = errors.New("Connection lost")
+
+// ClientState is connection state of Client
+type ClientState int
+
+const (
+	ClientConnecting ClientState = iota
+	ClientConnected
+	ClientReconnecting
+	ClientClosed
+)
+
+func (s ClientState) String() string {
+	switch s {
+	case ClientConnecting:
+		return "connecting"
+	case ClientConnected:
+		return "connected"
+	case ClientReconnecting:
+		return "reconnecting"
+	case ClientClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+type ClientStateHandlerFn func(c *Client, state ClientState)
+
+// PendingPolicy decides what happens with requests pending when connection is lost
+type PendingPolicy int
+
+const (
+	// PendingFail fails pending requests with ErrConnectionLost
+	PendingFail PendingPolicy = iota
+	// PendingRetry sends pending requests again after reconnect, within their request timeout
+	PendingRetry
+)
+
+// ReconnectOptions configures reconnecting of Client. Backoff grows from MinBackoff by Multiplier up to MaxBackoff
+// and every wait is randomized by Jitter fraction.
+type ReconnectOptions struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+	Jitter     float64
+	// MaxAttempts after which client is closed. 0 is unlimited
+	MaxAttempts int
+	Pending     PendingPolicy
+	// Resubscribe restores server side subscriptions. It is called after reconnect, unless server resumed session.
+	// Subscriptions made with Client.Subscribe are restored by client
+	Resubscribe func(c *Client) error
+}
+
+// WithReconnect enables reconnecting when connection is lost. Zero options get defaults
+func WithReconnect(opts ReconnectOptions) DialOption {
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = 2
+	}
+	if opts.Jitter <= 0 || opts.Jitter > 1 {
+		opts.Jitter = 0.2
+	}
+
+	return func(c *Client) {
+		c.reconnect = &opts
+	}
+}
+
+// WithStateHandler sets function called on every client state change
+func WithStateHandler(fn ClientStateHandlerFn) DialOption {
+	return func(c *Client) {
+		c.onState = fn
+	}
+}
+
+func (c *Client) State() ClientState {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.state
+}
+
+func (c *Client) setState(state ClientState) {
+	c.mutex.Lock()
+	if c.state == state || c.state == ClientClosed {
+		c.mutex.Unlock()
+		return
+	}
+	c.state = state
+	fn := c.onState
+	c.mutex.Unlock()
+
+	c.log.Debugf("Client state %s", state)
+	if state == ClientClosed {
+		c.closeSubscriptions()
+	}
+	if fn != nil {
+		fn(c, state)
+	}
+}
+
+func (c *Client) retryPending() bool {
+	return c.reconnect != nil && c.reconnect.Pending == PendingRetry
+}
+
+// waitReconnect waits for running reconnect. It returns true if client is connected again
+func (c *Client) waitReconnect(done <-chan struct{}) bool {
+	c.mutex.RLock()
+	reconnected := c.reconnected
+	c.mutex.RUnlock()
+
+	if reconnected != nil {
+		select {
+		case <-reconnected:
+		case <-done:
+			return false
+		}
+	}
+	return c.State() == ClientConnected
+}
+
+// backoff returns wait before reconnect attempt, starting with 1
+func (o *ReconnectOptions) backoff(attempt int) time.Duration {
+	return backoff(o.MinBackoff, o.MaxBackoff, o.Multiplier, o.Jitter, attempt)
+}
+
+// backoff returns exponential backoff of attempt, starting with 1, randomized by jitter fraction
+func backoff(min time.Duration, max time.Duration, multiplier float64, jitter float64, attempt int) time.Duration {
+	d := float64(min)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= multiplier
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	d += d * jitter * (2*rand.Float64() - 1)
+	return time.Duration(d)
+}
+
+func (c *Client) reconnectLoop() {
+	c.setState(ClientReconnecting)
+
+	c.mutex.RLock()
+	reconnected := c.reconnected
+	c.mutex.RUnlock()
+	defer close(reconnected)
+
+	opts := c.reconnect
+	for attempt := 1; opts.MaxAttempts == 0 || attempt <= opts.MaxAttempts; attempt++ {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(opts.backoff(attempt)):
+		}
+
+		t, err := c.redial()
+		if err != nil {
+			c.log.Warnf("Reconnect failed attempt=%d err=%s", attempt, err)
+			continue
+		}
+
+		c.mutex.RLock()
+		handler := c.eventHandler
+		resumed := c.resumed
+		c.mutex.RUnlock()
+
+		if !c.start(t, handler) {
+			//Closed while dialing
+			return
+		}
+		c.log.Infof("Reconnected attempt=%d resumed=%v", attempt, resumed)
+		//Server drops subscriptions with connection, even when session is resumed
+		c.restoreSubscriptions()
+		if !resumed && opts.Resubscribe != nil {
+			if err := opts.Resubscribe(c); err != nil {
+				c.log.Warnf("Resubscribe failed err=%s", err)
+			}
+		}
+		return
+	}
+
+	c.log.Warnf("Reconnect gave up after attempts=%d", opts.MaxAttempts)
+	c.setState(ClientClosed)
+}
@@ -0,0 +1,146 @@
+package wsrest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reconnectServer() (*httptest.Server, string) {
+	var calls int32
+	router := NewRouter()
+	router.HandleFunc("/ping", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("pong"), http.StatusOK)
+	})
+	router.HandleFunc("/restart", func(c *Conn, m *Request) {
+		c.Close(1012, "restart")
+	})
+	router.HandleFunc("/once", func(c *Conn, m *Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			c.Close(1012, "restart")
+			return
+		}
+		c.Respond(m, SimpleMsg("done"), http.StatusOK)
+	})
+
+	server := httptest.NewServer(NewHandler(router))
+	return server, strings.Replace(server.URL, "http", "ws", 1)
+}
+
+type stateRecorder struct {
+	mutex  sync.Mutex
+	states []ClientState
+}
+
+func (r *stateRecorder) handle(c *Client, state ClientState) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.states = append(r.states, state)
+}
+
+func (r *stateRecorder) get() []ClientState {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]ClientState{}, r.states...)
+}
+
+func TestClientReconnect(t *testing.T) {
+	server, domain := reconnectServer()
+	defer server.Close()
+
+	var resubscribed int32
+	states := &stateRecorder{}
+	c, err := Dial(domain, nil,
+		WithStateHandler(states.handle),
+		WithReconnect(ReconnectOptions{
+			MinBackoff: 10 * time.Millisecond,
+			Resubscribe: func(c *Client) error {
+				atomic.AddInt32(&resubscribed, 1)
+				return nil
+			},
+		}),
+	)
+	require.Nil(t, err)
+	defer c.Close()
+
+	_, err = c.Get("/restart", nil)
+	assert.Equal(t, ErrConnectionLost, err)
+
+	assert.Eventually(t, func() bool { return len(states.get()) == 3 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []ClientState{ClientConnected, ClientReconnecting, ClientConnected}, states.get())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&resubscribed))
+
+	res, err := c.Get("/ping", nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.GetCode())
+
+	c.Close()
+	assert.Equal(t, ClientClosed, c.State())
+}
+
+func TestClientReconnectPendingRetry(t *testing.T) {
+	server, domain := reconnectServer()
+	defer server.Close()
+
+	c, err := Dial(domain, nil, WithReconnect(ReconnectOptions{
+		MinBackoff: 10 * time.Millisecond,
+		Pending:    PendingRetry,
+	}))
+	require.Nil(t, err)
+	defer c.Close()
+
+	res, err := c.Get("/once", nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.GetCode())
+}
+
+func TestClientReconnectGiveUp(t *testing.T) {
+	server, domain := reconnectServer()
+
+	states := &stateRecorder{}
+	c, err := Dial(domain, nil,
+		WithStateHandler(states.handle),
+		WithReconnect(ReconnectOptions{MinBackoff: 10 * time.Millisecond, MaxAttempts: 2}),
+	)
+	require.Nil(t, err)
+	defer c.Close()
+
+	//Websocket is hijacked and stays open after server is closed
+	server.Close()
+	_, err = c.Get("/restart", nil)
+	assert.Equal(t, ErrConnectionLost, err)
+
+	assert.Eventually(t, func() bool { return c.State() == ClientClosed }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []ClientState{ClientConnected, ClientReconnecting, ClientClosed}, states.get())
+
+	_, err = c.Get("/ping", nil)
+	assert.NotNil(t, err)
+}
+
+func TestClientWithoutReconnect(t *testing.T) {
+	server, domain := reconnectServer()
+	defer server.Close()
+
+	c, err := Dial(domain, nil)
+	require.Nil(t, err)
+	defer c.Close()
+
+	_, err = c.Get("/restart", nil)
+	assert.Equal(t, ErrConnectionLost, err)
+	assert.Eventually(t, func() bool { return c.State() == ClientClosed }, time.Second, 10*time.Millisecond)
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	o := ReconnectOptions{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2, Jitter: 0.1}
+	for attempt, expected := range map[int]time.Duration{1: 100, 2: 200, 3: 400, 4: 800, 5: 1000, 10: 1000} {
+		d := o.backoff(attempt)
+		assert.InDelta(t, float64(expected*time.Millisecond), float64(d), float64(expected*time.Millisecond)/10+1, "attempt %d", attempt)
+	}
+}
@@ -1,11 +1,13 @@
 package wsrest
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"wsrest/tracing"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -21,11 +23,14 @@ type IRequest interface {
 }
 
 type Request struct {
-	UID      string           `json:"uid"`
-	Method   string           `json:"m"`
-	Resource string           `json:"r"`
-	Code     int              `json:"c"`
-	Data     *json.RawMessage `json:"d"`
+	UID         string            `json:"uid"`
+	Method      string            `json:"m"`
+	Resource    string            `json:"r"`
+	Code        int               `json:"c"`
+	Data        *json.RawMessage  `json:"d"`
+	TraceParent string            `json:"tp,omitempty"`
+	Header      map[string]string `json:"h,omitempty"`
+	ctx         context.Context
 }
 
 func NewRequest(method string, resource string, data interface{}) (*Request, error) {
@@ -70,9 +75,16 @@ func ParseHttpRequest(r *http.Request) (*Request, error) {
 	defer r.Body.Close()
 
 	m := &Request{
-		Method:   r.Method,
-		Resource: r.RequestURI,
-		Data:     &data,
+		Method:      r.Method,
+		Resource:    r.RequestURI,
+		Data:        &data,
+		TraceParent: r.Header.Get(tracing.Header),
+		ctx:         r.Context(),
+	}
+	for k, v := range r.Header {
+		if len(v) > 0 {
+			m.SetHeader(k, v[0])
+		}
 	}
 
 	return m, nil
@@ -92,8 +104,24 @@ func SimpleMsg(m string, args ...interface{}) SimpleMessage {
 	}
 }
 
+// Context returns request context. For server requests it carries trace of handler span
+func (cr *Request) Context() context.Context {
+	if cr.ctx == nil {
+		return context.Background()
+	}
+	return cr.ctx
+}
+
+// WithContext returns shallow copy of request with context
+func (cr *Request) WithContext(ctx context.Context) *Request {
+	r := *cr
+	r.ctx = ctx
+	return &r
+}
+
+// GetUID returns request unique id
 func (cr *Request) GetUID() string {
-	return cr.Method
+	return cr.UID
 }
 
 func (cr *Request) GetMethod() string {
@@ -116,6 +144,34 @@ func (cr *Request) GetPath() string {
 	return u.Path
 }
 
+// GetParams returns query parameters of resource. Only first value of each parameter is kept
+func (cr *Request) GetParams() map[string]string {
+	params := make(map[string]string)
+	u, err := url.Parse(cr.Resource)
+	if err != nil {
+		return params
+	}
+
+	for k, v := range u.Query() {
+		if len(v) > 0 {
+			params[k] = v[0]
+		}
+	}
+	return params
+}
+
+// GetHeader returns envelope header. On REST requests these are HTTP headers
+func (cr *Request) GetHeader(key string) string {
+	return cr.Header[http.CanonicalHeaderKey(key)]
+}
+
+func (cr *Request) SetHeader(key string, value string) {
+	if cr.Header == nil {
+		cr.Header = make(map[string]string)
+	}
+	cr.Header[http.CanonicalHeaderKey(key)] = value
+}
+
 func (cr *Request) GetCode() int {
 	return cr.Code
 }
@@ -84,3 +84,28 @@ func TestRequestSetData(t *testing.T) {
 		assert.Equal(t, testdata, out, "Unmarshaling not equal")
 	})
 }
+
+func TestRequestHeader(t *testing.T) {
+	r := httptest.NewRequest("GET", "/go", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	m, err := ParseHttpRequest(r)
+	require.Nil(t, err)
+	assert.Equal(t, "Bearer token", m.GetHeader("authorization"))
+
+	m, _ = NewRequest("GET", "/go", nil)
+	data, _ := json.Marshal(m)
+	assert.NotContains(t, string(data), `"h"`)
+
+	m.SetHeader("x-custom", "1")
+	data, _ = json.Marshal(m)
+	parsed := &Request{}
+	require.Nil(t, json.Unmarshal(data, parsed))
+	assert.Equal(t, "1", parsed.GetHeader("X-Custom"))
+}
+
+func TestRequestUID(t *testing.T) {
+	m, err := NewRequest("GET", "/go", nil)
+	require.Nil(t, err)
+	assert.NotEmpty(t, m.GetUID())
+	assert.Equal(t, m.UID, m.GetUID())
+}
@@ -0,0 +1,118 @@
+package wsrest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// IdempotencyKeyHeader is envelope header, or HTTP header on REST, identifying repeated request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryPolicy configures retrying of Client requests. Backoff grows from MinBackoff by Multiplier up to MaxBackoff
+// and every wait is randomized by Jitter fraction. Zero fields get defaults.
+type RetryPolicy struct {
+	// MaxAttempts including first one. Default 3
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	Multiplier  float64
+	Jitter      float64
+	// RetryableCodes are response codes which are retried. Default 502, 503 and 504
+	RetryableCodes []int
+	// Methods which are retried. Default are idempotent methods GET, HEAD, OPTIONS, PUT and DELETE
+	Methods []string
+	// AttemptTimeout limits single attempt, so timed out attempt can be retried within request timeout
+	AttemptTimeout time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = 0.2
+	}
+	if p.RetryableCodes == nil {
+		p.RetryableCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	if p.Methods == nil {
+		p.Methods = []string{"GET", "HEAD", "OPTIONS", "PUT", "DELETE"}
+	}
+	return p
+}
+
+func (p *RetryPolicy) allows(method string) bool {
+	for _, m := range p.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// retryable reports if attempt failed with transient error or retryable response code.
+// Transient errors are timeouts and lost or missing connection
+func (p *RetryPolicy) retryable(res *Request, err error) bool {
+	if err != nil {
+		return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrConnectionLost) || errors.Is(err, ErrNoConnection)
+	}
+
+	for _, code := range p.RetryableCodes {
+		if res.GetCode() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRetry retries failed requests by policy, see RetryInterceptor
+func WithRetry(p RetryPolicy) DialOption {
+	return WithInterceptors(RetryInterceptor(p))
+}
+
+// RetryInterceptor retries requests failing with transient error or retryable code, while request context is not done.
+// Idempotency key is attached to every request, so server can dedupe retried request, see Dedupe
+func RetryInterceptor(p RetryPolicy) Interceptor {
+	p = p.withDefaults()
+	return func(ctx context.Context, m *Request, next Invoker) (*Request, error) {
+		if m.GetHeader(IdempotencyKeyHeader) == "" {
+			m.SetHeader(IdempotencyKeyHeader, uuid.NewV4().String())
+		}
+
+		if !p.allows(m.GetMethod()) {
+			return next(ctx, m)
+		}
+
+		for attempt := 1; ; attempt++ {
+			actx, cancel := ctx, context.CancelFunc(func() {})
+			if p.AttemptTimeout > 0 {
+				actx, cancel = context.WithTimeout(ctx, p.AttemptTimeout)
+			}
+			res, err := next(actx, m)
+			cancel()
+
+			if attempt >= p.MaxAttempts || ctx.Err() != nil || !p.retryable(res, err) {
+				return res, err
+			}
+
+			select {
+			case <-ctx.Done():
+				return res, err
+			case <-time.After(backoff(p.MinBackoff, p.MaxBackoff, p.Multiplier, p.Jitter, attempt)):
+			}
+		}
+	}
+}
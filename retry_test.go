@@ -0,0 +1,135 @@
+package wsrest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flakyRoute struct {
+	mutex sync.Mutex
+	keys  []string
+	fails int
+}
+
+func (f *flakyRoute) handle(c *Conn, m *Request) {
+	f.mutex.Lock()
+	f.keys = append(f.keys, m.GetHeader(IdempotencyKeyHeader))
+	fail := len(f.keys) <= f.fails
+	f.mutex.Unlock()
+
+	if fail {
+		c.Respond(m, SimpleMsg("unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+}
+
+func (f *flakyRoute) calls() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string{}, f.keys...)
+}
+
+func TestClientRetry(t *testing.T) {
+	policy := RetryPolicy{MinBackoff: time.Millisecond}
+
+	t.Run("RetryableCode", func(t *testing.T) {
+		route := &flakyRoute{fails: 2}
+		router := NewRouter()
+		router.HandleFunc("/flaky", route.handle)
+		c := pipeClient(t, router, WithRetry(policy))
+
+		res, err := c.Get("/flaky", nil)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.GetCode())
+
+		keys := route.calls()
+		require.Len(t, keys, 3)
+		assert.NotEmpty(t, keys[0])
+		assert.Equal(t, keys[0], keys[1])
+		assert.Equal(t, keys[0], keys[2])
+	})
+
+	t.Run("MaxAttempts", func(t *testing.T) {
+		route := &flakyRoute{fails: 5}
+		router := NewRouter()
+		router.HandleFunc("/flaky", route.handle)
+		c := pipeClient(t, router, WithRetry(policy))
+
+		res, err := c.Get("/flaky", nil)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.GetCode())
+		assert.Len(t, route.calls(), 3)
+	})
+
+	t.Run("NonIdempotentMethod", func(t *testing.T) {
+		route := &flakyRoute{fails: 1}
+		router := NewRouter()
+		router.HandleFunc("/flaky", route.handle)
+		c := pipeClient(t, router, WithRetry(policy))
+
+		res, err := c.Post("/flaky", nil)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.GetCode())
+		keys := route.calls()
+		require.Len(t, keys, 1)
+		assert.NotEmpty(t, keys[0])
+	})
+
+	t.Run("AttemptTimeout", func(t *testing.T) {
+		var mutex sync.Mutex
+		calls := 0
+		router := NewRouter()
+		router.HandleFunc("/slow", func(c *Conn, m *Request) {
+			mutex.Lock()
+			calls++
+			first := calls == 1
+			mutex.Unlock()
+			if first {
+				time.Sleep(200 * time.Millisecond)
+			}
+			c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+		})
+		p := policy
+		p.AttemptTimeout = 50 * time.Millisecond
+		c := pipeClient(t, router, WithRetry(p))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		res, err := c.GetContext(ctx, "/slow", nil)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.GetCode())
+	})
+
+	t.Run("TransientErrors", func(t *testing.T) {
+		for _, tc := range []struct {
+			err      error
+			attempts int
+		}{
+			{ErrConnectionLost, 3},
+			{ErrNoConnection, 3},
+			{fmt.Errorf("Timeout occured: %w", context.DeadlineExceeded), 3},
+			{ErrTooManyInFlight, 1},
+			{errors.New("json: unsupported type"), 1},
+		} {
+			attempts := 0
+			failing := func(ctx context.Context, m *Request, next Invoker) (*Request, error) {
+				attempts++
+				return nil, tc.err
+			}
+			c := pipeClient(t, NewRouter(), WithInterceptors(RetryInterceptor(policy), failing))
+
+			_, err := c.Get("/any", nil)
+			assert.True(t, errors.Is(err, tc.err))
+			assert.Equal(t, tc.attempts, attempts, tc.err.Error())
+		}
+	})
+}
@@ -4,14 +4,31 @@ package wsrest
 
 type RouteHandlerFn func(*Conn, *Request)
 
+// AccessPolicyFn decides if principal can access route. Principal is nil for anonymous connection.
+// Returning error denies access, use AuthError to control status code.
+type AccessPolicyFn func(p *Principal, method string, path string, params map[string]string) error
+
+// AccessDeniedFn is called for every denied request. Use it for auditing
+type AccessDeniedFn func(wsc *Conn, m *Request, err error)
+
+// MiddlewareFn wraps route handler. Response of handler is available in request code and data after next returns
+type MiddlewareFn func(next RouteHandlerFn) RouteHandlerFn
+
 type Router interface {
 	Match(path string, method string) (*Route, bool)
 }
 
 type Route struct {
-	method  string
-	path    string
-	handler RouteHandlerFn
+	method       string
+	path         string
+	handler      RouteHandlerFn
+	roles        []string
+	scopes       []string
+	policies     []AccessPolicyFn
+	rateLimit    RateLimit
+	dispatchMode DispatchMode
+	dispatchKey  DispatchKeyFn
+	router       *FastRouter
 }
 
 func (r *Route) Method(m string) *Route {
@@ -19,8 +36,86 @@ func (r *Route) Method(m string) *Route {
 	return r
 }
 
+// Require allows access only to principals having any of roles
+func (r *Route) Require(roles ...string) *Route {
+	r.roles = append(r.roles, roles...)
+	return r
+}
+
+// RequireScope allows access only to principals having all scopes
+func (r *Route) RequireScope(scopes ...string) *Route {
+	r.scopes = append(r.scopes, scopes...)
+	return r
+}
+
+// Policy adds custom access policy. All policies must allow access
+func (r *Route) Policy(fn AccessPolicyFn) *Route {
+	r.policies = append(r.policies, fn)
+	return r
+}
+
+// RateLimit limits requests on this route per connection
+func (r *Route) RateLimit(rate float64, burst int) *Route {
+	r.rateLimit = RateLimit{Rate: rate, Burst: burst}
+	return r
+}
+
+// Dispatch overrides connection dispatch mode for this route. keyFn is used only for DispatchKeyed, nil means PathKey
+func (r *Route) Dispatch(mode DispatchMode, keyFn DispatchKeyFn) *Route {
+	r.dispatchMode = mode
+	r.dispatchKey = keyFn
+	return r
+}
+
+// Run runs route handler wrapped in router middlewares
 func (r *Route) Run(wsc *Conn, m *Request) {
-	r.handler(wsc, m)
+	handler := r.handler
+	if r.router != nil {
+		for i := len(r.router.middlewares) - 1; i >= 0; i-- {
+			handler = r.router.middlewares[i](handler)
+		}
+	}
+	handler(wsc, m)
+}
+
+// Authorize checks route roles, scopes and policies against principal
+func (r *Route) Authorize(p *Principal, method string, path string, params map[string]string) error {
+	if (len(r.roles) > 0 || len(r.scopes) > 0) && p == nil {
+		return ErrUnauthorized
+	}
+
+	if len(r.roles) > 0 {
+		allowed := false
+		for _, role := range r.roles {
+			if p.HasRole(role) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return ErrForbidden
+		}
+	}
+
+	for _, s := range r.scopes {
+		if !p.HasScope(s) {
+			return ErrForbidden
+		}
+	}
+
+	for _, fn := range r.policies {
+		if err := fn(p, method, path, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Route) accessDenied(wsc *Conn, m *Request, err error) {
+	if r.router == nil || r.router.onAccessDenied == nil {
+		return
+	}
+	r.router.onAccessDenied(wsc, m, err)
 }
 
 type RoutesSorted []*Route
@@ -6,7 +6,9 @@ import (
 )
 
 type FastRouter struct {
-	routes map[string]*Route
+	routes         map[string]*Route
+	onAccessDenied AccessDeniedFn
+	middlewares    []MiddlewareFn
 }
 
 func NewRouter() *FastRouter {
@@ -21,12 +23,23 @@ func (r *FastRouter) HandleFunc(regex string, handler RouteHandlerFn) *Route {
 	route := &Route{
 		path:    regex,
 		handler: handler,
+		router:  r,
 	}
 
 	r.routes[route.path] = route
 	return route
 }
 
+// OnAccessDenied sets hook called for every request denied by route authorization
+func (r *FastRouter) OnAccessDenied(fn AccessDeniedFn) {
+	r.onAccessDenied = fn
+}
+
+// Use adds middlewares to all routes. First middleware is outermost
+func (r *FastRouter) Use(middlewares ...MiddlewareFn) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
 func (r *FastRouter) String() string {
 	result := ""
 
@@ -0,0 +1,272 @@
+package wsrest
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// SessionHeader carries session id in upgrade response, and in upgrade request when resuming
+	SessionHeader = "X-Wsrest-Session"
+	// SessionAckHeader is number of frames client received in session before reconnect
+	SessionAckHeader = "X-Wsrest-Session-Ack"
+	// SessionResumedHeader tells client if session is resumed or new one is created
+	SessionResumedHeader = "X-Wsrest-Session-Resumed"
+
+	// Query parameters can be used instead of headers, for browsers
+	sessionQuery    = "session"
+	sessionAckQuery = "ack"
+)
+
+type sessionFrame struct {
+	seq  uint64
+	data []byte
+}
+
+// Session keeps connection state over websocket reconnects
+type Session struct {
+	ID        string
+	mutex     sync.Mutex
+	vars      map[string]interface{}
+	principal string
+	frames    []sessionFrame
+	seq       uint64 //Number of frames sent in session
+	conn      *Conn
+	replaced  *Conn //Connection detached on resume, closed once new one is attached
+	expire    *time.Timer
+}
+
+// record stores frame written to client
+func (s *Session) record(data []byte, size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.add(data, size)
+}
+
+// recordFrom stores frame written by connection, only while connection is attached to session.
+// Frames of replaced connection would take sequence numbers of frames client never gets
+func (s *Session) recordFrom(wsc *Conn, data []byte, size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn != wsc {
+		return
+	}
+	s.add(data, size)
+}
+
+// add must be called under lock
+func (s *Session) add(data []byte, size int) {
+	s.seq++
+	s.frames = append(s.frames, sessionFrame{seq: s.seq, data: data})
+	if len(s.frames) > size {
+		s.frames = s.frames[len(s.frames)-size:]
+	}
+}
+
+// unacked returns frames after ack. It returns false if some frames are not buffered anymore
+func (s *Session) unacked(ack uint64) ([][]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.unackedLocked(ack)
+}
+
+// resume returns frames after ack and detaches current connection, so replay is not missing frames it writes later
+func (s *Session) resume(ack uint64) ([][]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	frames, ok := s.unackedLocked(ack)
+	if ok && s.conn != nil {
+		s.replaced = s.conn
+		s.conn = nil
+	}
+	return frames, ok
+}
+
+func (s *Session) getVar(name string) (interface{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, exists := s.vars[name]
+	return value, exists
+}
+
+func (s *Session) setVar(name string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.vars[name] = value
+}
+
+func (s *Session) delVar(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.vars, name)
+}
+
+// unackedLocked must be called under lock
+func (s *Session) unackedLocked(ack uint64) ([][]byte, bool) {
+	if ack > s.seq {
+		return nil, false
+	}
+
+	if ack == s.seq {
+		return nil, true
+	}
+
+	if len(s.frames) == 0 || s.frames[0].seq > ack+1 {
+		return nil, false
+	}
+
+	frames := make([][]byte, 0, s.seq-ack)
+	for _, f := range s.frames {
+		if f.seq > ack {
+			frames = append(frames, f.data)
+		}
+	}
+	return frames, true
+}
+
+// SessionManager issues sessions on websocket connect and resumes them on reconnect.
+// Detached session is kept for grace period with bounded buffer of sent frames, which are replayed on resume.
+type SessionManager struct {
+	mutex      sync.Mutex
+	grace      time.Duration
+	bufferSize int
+	sessions   map[string]*Session
+}
+
+func NewSessionManager(grace time.Duration, bufferSize int) *SessionManager {
+	return &SessionManager{
+		grace:      grace,
+		bufferSize: bufferSize,
+		sessions:   make(map[string]*Session),
+	}
+}
+
+// open resumes session requested by r or creates new one. It returns frames that must be replayed
+func (m *SessionManager) open(r *http.Request, p *Principal) (*Session, [][]byte, bool) {
+	principal := ""
+	if p != nil {
+		principal = p.ID
+	}
+
+	id, ack := sessionRequest(r)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if s, exists := m.sessions[id]; exists && s.principal == principal {
+		if replay, ok := s.resume(ack); ok {
+			return s, replay, true
+		}
+	}
+
+	s := &Session{
+		ID:        uuid.NewV4().String(),
+		vars:      make(map[string]interface{}),
+		principal: principal,
+	}
+	m.sessions[s.ID] = s
+	return s, nil, false
+}
+
+func sessionRequest(r *http.Request) (string, uint64) {
+	id := r.Header.Get(SessionHeader)
+	ack := r.Header.Get(SessionAckHeader)
+	if id == "" {
+		q := r.URL.Query()
+		id = q.Get(sessionQuery)
+		ack = q.Get(sessionAckQuery)
+	}
+
+	n, _ := strconv.ParseUint(ack, 10, 64)
+	return id, n
+}
+
+// attach binds session to new connection. Previous connection of session is closed
+func (m *SessionManager) attach(s *Session, wsc *Conn, replay [][]byte) {
+	s.mutex.Lock()
+	if s.expire != nil {
+		s.expire.Stop()
+		s.expire = nil
+	}
+	prev := s.conn
+	if prev == nil {
+		prev = s.replaced
+	}
+	s.replaced = nil
+	s.conn = wsc
+	s.mutex.Unlock()
+
+	if prev != nil {
+		prev.Close(4001, "session resumed")
+	}
+
+	//Vars are kept by session, under its lock, as replaced connection can still be handling requests
+	wsc.Lock()
+	s.mutex.Lock()
+	for k, v := range wsc.Vars {
+		s.vars[k] = v
+	}
+	s.mutex.Unlock()
+	wsc.session = s
+	wsc.sessionBuffer = m.bufferSize
+	wsc.replay = replay
+	wsc.Unlock()
+
+	wsc.OnClose(func(wsc *Conn, info CloseInfo) {
+		m.detach(s, wsc)
+	})
+}
+
+func (m *SessionManager) detach(s *Session, wsc *Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.replaced == wsc {
+		//Closed before resuming connection is attached
+		s.replaced = nil
+	}
+	if s.conn != nil && s.conn != wsc || s.expire != nil {
+		return
+	}
+
+	s.conn = nil
+	s.expire = time.AfterFunc(m.grace, func() {
+		m.expire(s)
+	})
+}
+
+func (m *SessionManager) expire(s *Session) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn != nil {
+		return
+	}
+	delete(m.sessions, s.ID)
+}
+
+// remove drops session, for example when upgrade failed
+func (m *SessionManager) remove(s *Session) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.sessions, s.ID)
+}
+
+func (m *SessionManager) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.sessions)
+}
+
+// Session returns session of connection, if sessions are enabled
+func (wsc *Conn) Session() (*Session, bool) {
+	wsc.RLock()
+	defer wsc.RUnlock()
+	return wsc.session, wsc.session != nil
+}
@@ -0,0 +1,152 @@
+package wsrest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionUnacked(t *testing.T) {
+	s := &Session{}
+	for _, d := range []string{"a", "b", "c", "d"} {
+		s.record([]byte(d), 2)
+	}
+
+	frames, ok := s.unacked(2)
+	require.True(t, ok)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("d")}, frames)
+
+	frames, ok = s.unacked(4)
+	assert.True(t, ok)
+	assert.Empty(t, frames)
+
+	_, ok = s.unacked(1) //Frame b is not buffered anymore
+	assert.False(t, ok)
+	_, ok = s.unacked(5)
+	assert.False(t, ok)
+}
+
+func TestSessionRecordReplaced(t *testing.T) {
+	old, _ := NewPipe()
+	wsc := NewConn(old, NewRouter())
+	s := &Session{conn: wsc}
+	s.recordFrom(wsc, []byte("a"), 10)
+
+	frames, ok := s.resume(0)
+	require.True(t, ok)
+	assert.Equal(t, [][]byte{[]byte("a")}, frames)
+
+	//Replaced connection does not record frames, client will not get them
+	s.recordFrom(wsc, []byte("b"), 10)
+	frames, ok = s.unacked(1)
+	assert.True(t, ok)
+	assert.Empty(t, frames)
+}
+
+func TestSessionVars(t *testing.T) {
+	m := NewSessionManager(time.Minute, 10)
+	s, _, _ := m.open(httptest.NewRequest("GET", "/", nil), nil)
+
+	a, _ := NewPipe()
+	old := NewConn(a, NewRouter())
+	old.SetVar("before", 1)
+	m.attach(s, old, nil)
+
+	b, _ := NewPipe()
+	wsc := NewConn(b, NewRouter())
+	m.attach(s, wsc, nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			old.SetVar("old", i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		wsc.SetVar("new", i)
+	}
+	<-done
+
+	v, exists := wsc.GetVar("before")
+	assert.True(t, exists)
+	assert.Equal(t, 1, v)
+	v, _ = wsc.GetVar("old")
+	assert.Equal(t, 99, v)
+}
+
+func TestSessionResume(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/var", func(c *Conn, m *Request) {
+		if m.Method == "PUT" {
+			c.SetVar("name", string(m.GetData()))
+		}
+		v, _ := c.GetVar("name")
+		c.Respond(m, SimpleMsg("%v", v), http.StatusOK)
+	})
+	router.HandleFunc("/push", func(c *Conn, m *Request) {
+		for _, e := range []string{"e1", "e2", "e3"} {
+			c.WriteWS([]byte(`{"type":"` + e + `"}`))
+		}
+		c.Respond(m, SimpleMsg("pushed"), http.StatusOK)
+	})
+
+	h := NewHandler(router)
+	h.Sessions = NewSessionManager(time.Minute, 10)
+	server := httptest.NewServer(h)
+	defer server.Close()
+	domain := strings.Replace(server.URL, "http", "ws", 1)
+
+	conn, resp, err := websocket.DefaultDialer.Dial(domain, nil)
+	require.Nil(t, err)
+	sessionID := resp.Header.Get(SessionHeader)
+	require.NotEmpty(t, sessionID)
+	assert.Equal(t, "false", resp.Header.Get(SessionResumedHeader))
+
+	put, _ := NewRequest("PUT", "/var", `"john"`)
+	require.Nil(t, conn.WriteJSON(put))
+	_, _, err = conn.ReadMessage()
+	require.Nil(t, err)
+
+	push, _ := NewRequest("POST", "/push", nil)
+	require.Nil(t, conn.WriteJSON(push))
+	for i := 0; i < 4; i++ {
+		_, _, err = conn.ReadMessage()
+		require.Nil(t, err)
+	}
+	conn.Close()
+
+	//Pretend that only put response and first event were received before connection dropped
+	frames := make(chan string, 3)
+	client, err := Dial(domain, func(d []byte) { frames <- string(d) }, WithSession(sessionID, 2))
+	require.Nil(t, err)
+	defer client.Close()
+
+	assert.True(t, client.Resumed())
+	assert.Equal(t, `{"type":"e2"}`, <-frames)
+	assert.Equal(t, `{"type":"e3"}`, <-frames)
+	assert.Contains(t, <-frames, `"uid":"`+push.UID+`"`)
+
+	id, received := client.Session()
+	assert.Equal(t, sessionID, id)
+	assert.Equal(t, uint64(5), received)
+
+	res, err := client.Get("/var", nil)
+	require.Nil(t, err)
+	assert.Equal(t, `{"message":"\"john\""}`, string(res.GetData()))
+
+	//Unknown session gets new one
+	other, err := Dial(domain, nil, WithSession("unknown", 10))
+	require.Nil(t, err)
+	defer other.Close()
+	assert.False(t, other.Resumed())
+	id, received = other.Session()
+	assert.NotEqual(t, "unknown", id)
+	assert.Equal(t, uint64(0), received)
+}
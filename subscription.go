@@ -0,0 +1,155 @@
+package wsrest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// SubscriptionBuffer is number of events buffered for subscription. Events are dropped when buffer is full
+const SubscriptionBuffer = 256
+
+// Subscription receives events of topics subscribed with Client.Subscribe
+type Subscription struct {
+	ID     string
+	Topics []string
+
+	c      *Client
+	mutex  sync.Mutex
+	events chan *PushEvent
+	closed bool
+}
+
+// Subscribe subscribes to server PubSub topics, see PubSubBridge. Subscription is restored after reconnect.
+// Events channel is closed on Unsubscribe or when client is closed
+func (c *Client) Subscribe(ctx context.Context, topics ...string) (*Subscription, error) {
+	if c.HTTPMode() {
+		return nil, fmt.Errorf("Subscribe is not supported over HTTP")
+	}
+
+	s := &Subscription{
+		ID:     uuid.NewV4().String(),
+		Topics: topics,
+		c:      c,
+		events: make(chan *PushEvent, SubscriptionBuffer),
+	}
+
+	//Register before request, events can arrive before response
+	c.mutex.Lock()
+	if c.subscriptions == nil {
+		c.subscriptions = make(map[string]*Subscription)
+	}
+	c.subscriptions[s.ID] = s
+	c.mutex.Unlock()
+
+	if err := c.PostInto(ctx, SubscribePath, subscribeRequest{ID: s.ID, Topics: topics}, nil); err != nil {
+		c.removeSubscription(s.ID)
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Events returns channel of subscription events
+func (s *Subscription) Events() <-chan *PushEvent {
+	return s.events
+}
+
+// Unsubscribe removes subscription on server and closes events channel
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	if !s.c.removeSubscription(s.ID) {
+		return nil
+	}
+	s.close()
+	return s.c.PostInto(ctx, UnsubscribePath, subscribeRequest{ID: s.ID}, nil)
+}
+
+func (s *Subscription) deliver(e *PushEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.events <- e:
+	default:
+		s.c.log.Warnf("Subscription buffer is full, event dropped sub=%s topic=%s", s.ID, e.Topic)
+	}
+}
+
+func (s *Subscription) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.events)
+}
+
+func (c *Client) removeSubscription(id string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, exists := c.subscriptions[id]
+	delete(c.subscriptions, id)
+	return exists
+}
+
+// dispatchSubscription delivers subscription frame. It returns false if frame is not one
+func (c *Client) dispatchSubscription(message []byte) bool {
+	frame := subscriptionFrame{}
+	if err := json.Unmarshal(message, &frame); err != nil || frame.Sub == "" {
+		return false
+	}
+
+	c.mutex.RLock()
+	s, exists := c.subscriptions[frame.Sub]
+	c.mutex.RUnlock()
+	if !exists {
+		c.log.Debugf("Event of unknown subscription sub=%s", frame.Sub)
+		return true
+	}
+
+	e := &PushEvent{Raw: frame.Event, unmarshaler: c.Unmarshaler}
+	if err := json.Unmarshal(frame.Event, &e.Event); err != nil {
+		c.log.Warnf("Failed to decode event sub=%s err=%s", frame.Sub, err)
+		return true
+	}
+	s.deliver(e)
+	return true
+}
+
+// restoreSubscriptions subscribes again on new connection
+func (c *Client) restoreSubscriptions() {
+	c.mutex.RLock()
+	subs := make([]*Subscription, 0, len(c.subscriptions))
+	for _, s := range c.subscriptions {
+		subs = append(subs, s)
+	}
+	c.mutex.RUnlock()
+
+	for _, s := range subs {
+		ctx, cancel := context.WithTimeout(context.Background(), c.RequestTimeout)
+		err := c.PostInto(ctx, SubscribePath, subscribeRequest{ID: s.ID, Topics: s.Topics}, nil)
+		cancel()
+		if err != nil {
+			c.log.Warnf("Failed to restore subscription sub=%s err=%s", s.ID, err)
+		}
+	}
+}
+
+// closeSubscriptions closes events of all subscriptions
+func (c *Client) closeSubscriptions() {
+	c.mutex.Lock()
+	subs := c.subscriptions
+	c.subscriptions = nil
+	c.mutex.Unlock()
+
+	for _, s := range subs {
+		s.close()
+	}
+}
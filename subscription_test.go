@@ -0,0 +1,167 @@
+package wsrest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wsrest/pubsub"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveEvent(t *testing.T, s *Subscription) *PushEvent {
+	select {
+	case e, more := <-s.Events():
+		require.True(t, more, "Events are closed")
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("Event not received")
+	}
+	return nil
+}
+
+func TestClientSubscribe(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	bridge := NewPubSubBridge(ps)
+	router := NewRouter()
+	bridge.Register(router)
+
+	c := pipeClient(t, router)
+	ctx := context.Background()
+
+	users, err := c.Subscribe(ctx, "users")
+	require.NoError(t, err)
+	all, err := c.Subscribe(ctx, "users", "orders")
+	require.NoError(t, err)
+	assert.Equal(t, 2, bridge.Len())
+
+	ps.Publish(&pubsub.Event{Type: "created", Topic: "users", TopicId: "1"})
+	ps.Publish(&pubsub.Event{Type: "created", Topic: "orders", TopicId: "2"})
+
+	e := receiveEvent(t, users)
+	assert.Equal(t, "users", e.Topic)
+	assert.Equal(t, "1", e.TopicId)
+
+	var data struct {
+		Type string `json:"type"`
+	}
+	require.NoError(t, e.Decode(&data))
+	assert.Equal(t, "created", data.Type)
+
+	assert.Equal(t, "1", receiveEvent(t, all).TopicId)
+	assert.Equal(t, "2", receiveEvent(t, all).TopicId)
+
+	require.NoError(t, users.Unsubscribe(ctx))
+	_, more := <-users.Events()
+	assert.False(t, more)
+	assert.Equal(t, 1, bridge.Len())
+
+	ps.Publish(&pubsub.Event{Type: "deleted", Topic: "users", TopicId: "3"})
+	assert.Equal(t, "3", receiveEvent(t, all).TopicId)
+
+	//Subscriptions are removed with connection
+	c.Close()
+	_, more = <-all.Events()
+	assert.False(t, more)
+	assert.Eventually(t, func() bool { return bridge.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestClientSubscribeDenied(t *testing.T) {
+	bridge := NewPubSubBridge(pubsub.NewPubSub())
+	bridge.Authorize = func(wsc *Conn, topics []string) error {
+		return errors.New("private")
+	}
+	router := NewRouter()
+	bridge.Register(router)
+
+	c := pipeClient(t, router)
+	_, err := c.Subscribe(context.Background(), "secret")
+	require.Error(t, err)
+	serr, ok := err.(*StatusError)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusForbidden, serr.Code)
+	assert.Equal(t, 0, bridge.Len())
+	assert.Equal(t, 0, len(c.subscriptions))
+}
+
+func TestClientSubscribeReconnect(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	bridge := NewPubSubBridge(ps)
+	router := NewRouter()
+	bridge.Register(router)
+	router.HandleFunc("/restart", func(c *Conn, m *Request) {
+		c.Close(1012, "restart")
+	})
+	server := httptest.NewServer(NewHandler(router))
+	defer server.Close()
+
+	c, err := Dial(strings.Replace(server.URL, "http", "ws", 1), nil,
+		WithReconnect(ReconnectOptions{MinBackoff: 10 * time.Millisecond}),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	s, err := c.Subscribe(context.Background(), "users")
+	require.NoError(t, err)
+
+	_, err = c.Get("/restart", nil)
+	assert.Equal(t, ErrConnectionLost, err)
+	assert.Eventually(t, func() bool { return c.State() == ClientConnected && bridge.Len() == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	ps.Publish(&pubsub.Event{Type: "created", Topic: "users", TopicId: "1"})
+	assert.Equal(t, "1", receiveEvent(t, s).TopicId)
+}
+
+// slowSubscriber subscribes on connection whose client never reads
+func slowSubscriber(t *testing.T, bridge *PubSubBridge) (*Conn, *PipeTransport) {
+	router := NewRouter()
+	bridge.Register(router)
+	client, server := NewPipe()
+	wsc := NewConn(server, router)
+	go wsc.Serve()
+
+	m, err := NewRequest("POST", SubscribePath, subscribeRequest{ID: "slow", Topics: []string{"users"}})
+	require.NoError(t, err)
+	data, _ := json.Marshal(m)
+	require.NoError(t, client.WriteFrame(data))
+	assert.Eventually(t, func() bool { return bridge.Len() == 1 }, time.Second, 5*time.Millisecond)
+	return wsc, client
+}
+
+func TestPubSubBridgeSlowClient(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	bridge := NewPubSubBridge(ps)
+	bridge.Buffer = 4
+	wsc, client := slowSubscriber(t, bridge)
+	defer client.Close(websocket.CloseNormalClosure, "")
+
+	fast := pubsub.Subscriber{Id: "fast", Topics: []string{"users"}, Pipe: make(chan []byte, 1000)}
+	<-ps.Subscribe(fast)
+
+	//Slow client does not block delivery to other subscribers
+	for i := 0; i < 500; i++ {
+		ps.Publish(&pubsub.Event{Type: "created", Topic: "users"})
+	}
+	assert.Eventually(t, func() bool { return len(fast.Pipe) == 500 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, StateOpen, wsc.State())
+}
+
+func TestPubSubBridgeDisconnectSlow(t *testing.T) {
+	ps := pubsub.NewPubSub()
+	bridge := NewPubSubBridge(ps)
+	bridge.Buffer = 4
+	bridge.DisconnectSlow = true
+	wsc, _ := slowSubscriber(t, bridge)
+
+	for i := 0; i < 500; i++ {
+		ps.Publish(&pubsub.Event{Type: "created", Topic: "users"})
+	}
+	assert.Eventually(t, func() bool { return wsc.IsClosed() && bridge.Len() == 0 }, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,181 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Header is W3C trace context HTTP header
+const Header = "traceparent"
+
+// SpanContext is W3C traceparent identity of span
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&0x01 == 0x01
+}
+
+// TraceParent formats span context as traceparent value
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), sc.Flags)
+}
+
+// ParseTraceParent parses traceparent value like 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceParent(s string) (SpanContext, error) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("Invalid traceparent %q", s)
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("Invalid traceparent %q", s)
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("Invalid traceparent trace id: %s", err)
+	}
+
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("Invalid traceparent span id: %s", err)
+	}
+
+	flags := []byte{0}
+	if _, err := hex.Decode(flags, []byte(parts[3])); err != nil {
+		return sc, fmt.Errorf("Invalid traceparent flags: %s", err)
+	}
+	sc.Flags = flags[0]
+
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("Invalid traceparent %q", s)
+	}
+	return sc, nil
+}
+
+// NewSpanContext creates child of parent, or new sampled trace if parent is not valid
+func NewSpanContext(parent SpanContext) SpanContext {
+	sc := SpanContext{Flags: 0x01}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	return sc
+}
+
+type spanContextKey struct{}
+
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// ContextWithTraceParent adds remote span context from traceparent value. Invalid value is ignored
+func ContextWithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+
+	sc, err := ParseTraceParent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// TraceParent returns traceparent of span in context, or empty string
+func TraceParent(ctx context.Context) string {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return sc.TraceParent()
+}
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+)
+
+type Span interface {
+	SpanContext() SpanContext
+	SetAttribute(key string, value interface{})
+	SetError(err error)
+	End()
+}
+
+// Tracer creates spans. Returned context must carry span context of new span
+type Tracer interface {
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+var (
+	tracerMutex sync.RWMutex
+	tracer      Tracer = propagatingTracer{}
+)
+
+// SetTracer sets global tracer used by wsrest. Default tracer only propagates context and does not record spans
+func SetTracer(t Tracer) {
+	tracerMutex.Lock()
+	defer tracerMutex.Unlock()
+	if t == nil {
+		t = propagatingTracer{}
+	}
+	tracer = t
+}
+
+func GetTracer() Tracer {
+	tracerMutex.RLock()
+	defer tracerMutex.RUnlock()
+	return tracer
+}
+
+// Start starts span with global tracer
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return GetTracer().Start(ctx, name, kind)
+}
+
+type propagatingTracer struct{}
+
+func (propagatingTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	parent, _ := SpanContextFromContext(ctx)
+	s := &propagatingSpan{sc: NewSpanContext(parent)}
+	return ContextWithSpanContext(ctx, s.sc), s
+}
+
+type propagatingSpan struct {
+	sc SpanContext
+}
+
+func (s *propagatingSpan) SpanContext() SpanContext                   { return s.sc }
+func (s *propagatingSpan) SetAttribute(key string, value interface{}) {}
+func (s *propagatingSpan) SetError(err error)                         {}
+func (s *propagatingSpan) End()                                       {}
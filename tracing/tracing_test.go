@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceParent(tp)
+	require.Nil(t, err)
+	assert.True(t, sc.IsSampled())
+	assert.Equal(t, tp, sc.TraceParent())
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+	}
+	for _, s := range invalid {
+		_, err := ParseTraceParent(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestStartPropagates(t *testing.T) {
+	ctx := ContextWithTraceParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	parent, ok := SpanContextFromContext(ctx)
+	require.True(t, ok)
+
+	ctx, span := Start(ctx, "child", SpanKindClient)
+	defer span.End()
+
+	child, ok := SpanContextFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, parent.TraceID, child.TraceID)
+	assert.NotEqual(t, parent.SpanID, child.SpanID)
+	assert.Equal(t, child, span.SpanContext())
+
+	_, root := Start(context.Background(), "root", SpanKindInternal)
+	assert.True(t, root.SpanContext().IsValid())
+	assert.NotEqual(t, parent.TraceID, root.SpanContext().TraceID)
+}
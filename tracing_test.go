@@ -0,0 +1,64 @@
+package wsrest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wsrest/pubsub"
+	"wsrest/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracePropagation(t *testing.T) {
+	traces := make(chan string, 2)
+
+	//Downstream service
+	downstream := NewRouter()
+	downstream.HandleFunc("/stock", func(c *Conn, m *Request) {
+		sc, _ := tracing.SpanContextFromContext(m.Context())
+		traces <- sc.TraceParent()
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	})
+	dserver := httptest.NewServer(NewHandler(downstream))
+	defer dserver.Close()
+
+	dclient, err := Dial(strings.Replace(dserver.URL, "http", "ws", 1), nil)
+	require.Nil(t, err)
+	defer dclient.Close()
+
+	events := pubsub.NewPubSub()
+	pipe := make(chan []byte, 1)
+	<-events.Subscribe(pubsub.Subscriber{Id: "test", Topics: []string{"orders"}, Pipe: pipe})
+
+	//Upstream service calls downstream and publishes event
+	upstream := NewRouter()
+	upstream.HandleFunc("/order", func(c *Conn, m *Request) {
+		req, _ := NewRequest("GET", "/stock", nil)
+		if _, err := dclient.Do(req.WithContext(m.Context())); err != nil {
+			c.Respond(m, SimpleMsg(err.Error()), http.StatusBadGateway)
+			return
+		}
+
+		e := pubsub.NewEvent("OrderCreated", "orders", "1")
+		events.PublishContext(m.Context(), &e)
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	})
+	userver := httptest.NewServer(NewHandler(upstream))
+	defer userver.Close()
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, err := http.NewRequest("POST", userver.URL+"/order", nil)
+	require.Nil(t, err)
+	req.Header.Set(tracing.Header, traceparent)
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	assert.Contains(t, <-traces, traceID)
+	assert.Contains(t, string(<-pipe), traceID)
+}
@@ -0,0 +1,244 @@
+package wsrest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries envelope frames of connection. Conn is built on it, so handlers do not depend on underlying protocol.
+// ReadFrame is called from single go routine and WriteFrame from other single go routine
+type Transport interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame(data []byte) error
+	// Close closes transport with websocket close code and reason. It must be safe to call it multiple times
+	Close(code int, reason string) error
+	RemoteAddr() string
+}
+
+// ResponseTransport is transport with single request and single response, like HTTP.
+// Request is parsed from it directly and response is written with status instead of envelope
+type ResponseTransport interface {
+	Transport
+	Request() *http.Request
+	WriteResponse(status int, data []byte) error
+}
+
+// Pinger is implemented by streaming transports which need keep alive. It is called periodically by write routine
+type Pinger interface {
+	Ping() error
+}
+
+// namedTransport names transport in logs and metrics
+type namedTransport interface {
+	Name() string
+}
+
+// headerTransport can set response headers
+type headerTransport interface {
+	Header() http.Header
+}
+
+// WSTransport is gorilla websocket transport
+type WSTransport struct {
+	conn *websocket.Conn
+	once sync.Once
+	// MessageType of written frames. Default is websocket.TextMessage
+	MessageType int
+}
+
+// NewWSTransport wraps upgraded websocket connection. Peer must answer pings in time, otherwise read fails
+func NewWSTransport(conn *websocket.Conn) *WSTransport {
+	t := newWSClientTransport(conn)
+	// conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(payload string) error {
+		observePong(payload)
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	return t
+}
+
+// newWSClientTransport wraps dialed connection, which only answers pings
+func newWSClientTransport(conn *websocket.Conn) *WSTransport {
+	return &WSTransport{conn: conn, MessageType: websocket.TextMessage}
+}
+
+// Conn returns underlying websocket connection
+func (t *WSTransport) Conn() *websocket.Conn {
+	return t.conn
+}
+
+func (t *WSTransport) ReadFrame() ([]byte, error) {
+	_, data, err := t.conn.ReadMessage()
+	return data, err
+}
+
+func (t *WSTransport) WriteFrame(data []byte) error {
+	t.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return t.conn.WriteMessage(t.MessageType, data)
+}
+
+func (t *WSTransport) Ping() error {
+	t.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return t.conn.WriteMessage(websocket.PingMessage, pingPayload())
+}
+
+// Close sends close message, if not already sent, and closes connection
+func (t *WSTransport) Close(code int, reason string) error {
+	var err error
+	t.once.Do(func() {
+		t.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+		err = t.conn.Close()
+	})
+	return err
+}
+
+func (t *WSTransport) RemoteAddr() string {
+	return t.conn.RemoteAddr().String()
+}
+
+func (t *WSTransport) Name() string {
+	return "ws"
+}
+
+// HTTPTransport is REST transport over HTTP request and response
+type HTTPTransport struct {
+	w    http.ResponseWriter
+	r    *http.Request
+	read bool
+}
+
+func NewHTTPTransport(w http.ResponseWriter, r *http.Request) *HTTPTransport {
+	return &HTTPTransport{w: w, r: r}
+}
+
+func (t *HTTPTransport) Request() *http.Request {
+	return t.r
+}
+
+func (t *HTTPTransport) Header() http.Header {
+	return t.w.Header()
+}
+
+// ReadFrame returns HTTP request as envelope. There is only one frame, after that io.EOF is returned
+func (t *HTTPTransport) ReadFrame() ([]byte, error) {
+	if t.read {
+		return nil, io.EOF
+	}
+	t.read = true
+
+	m, err := ParseHttpRequest(t.r)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func (t *HTTPTransport) WriteFrame(data []byte) error {
+	_, err := t.w.Write(data)
+	return err
+}
+
+func (t *HTTPTransport) WriteResponse(status int, data []byte) error {
+	if t.r.Response != nil {
+		t.r.Response.StatusCode = status
+	}
+
+	t.w.WriteHeader(status)
+	_, err := t.w.Write(data)
+	return err
+}
+
+// Close does nothing, response is finished when handler returns
+func (t *HTTPTransport) Close(code int, reason string) error {
+	return nil
+}
+
+func (t *HTTPTransport) RemoteAddr() string {
+	return t.r.RemoteAddr
+}
+
+func (t *HTTPTransport) Name() string {
+	return "rest"
+}
+
+// pipe is shared state of both pipe ends
+type pipe struct {
+	once   sync.Once
+	done   chan struct{}
+	code   int
+	reason string
+}
+
+// PipeTransport is one end of in memory transport created by NewPipe
+type PipeTransport struct {
+	pipe *pipe
+	in   chan []byte
+	out  chan []byte
+	addr string
+}
+
+// NewPipe creates connected in memory transports. Frames written on one end are read on other.
+// Closing any end closes both and read returns *websocket.CloseError with close code and reason
+func NewPipe() (*PipeTransport, *PipeTransport) {
+	p := &pipe{done: make(chan struct{})}
+	a := make(chan []byte, 64)
+	b := make(chan []byte, 64)
+	return &PipeTransport{pipe: p, in: a, out: b, addr: "pipe:b"},
+		&PipeTransport{pipe: p, in: b, out: a, addr: "pipe:a"}
+}
+
+func (t *PipeTransport) ReadFrame() ([]byte, error) {
+	//Frames written before close are still delivered
+	select {
+	case data := <-t.in:
+		return data, nil
+	case <-t.pipe.done:
+	}
+
+	select {
+	case data := <-t.in:
+		return data, nil
+	default:
+		return nil, &websocket.CloseError{Code: t.pipe.code, Text: t.pipe.reason}
+	}
+}
+
+func (t *PipeTransport) WriteFrame(data []byte) error {
+	select {
+	case <-t.pipe.done:
+		return fmt.Errorf("Pipe is closed")
+	default:
+	}
+
+	select {
+	case t.out <- data:
+		return nil
+	case <-t.pipe.done:
+		return fmt.Errorf("Pipe is closed")
+	}
+}
+
+func (t *PipeTransport) Close(code int, reason string) error {
+	t.pipe.once.Do(func() {
+		t.pipe.code = code
+		t.pipe.reason = reason
+		close(t.pipe.done)
+	})
+	return nil
+}
+
+func (t *PipeTransport) RemoteAddr() string {
+	return t.addr
+}
+
+func (t *PipeTransport) Name() string {
+	return "pipe"
+}
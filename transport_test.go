@@ -0,0 +1,90 @@
+package wsrest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeTransport(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/echo", func(c *Conn, m *Request) {
+		var s string
+		json.Unmarshal(m.GetData(), &s)
+		c.Respond(m, SimpleMsg(s), http.StatusOK)
+	})
+	router.HandleFunc("/bye", func(c *Conn, m *Request) {
+		c.Close(4000, "bye")
+	})
+
+	client, server := NewPipe()
+	wsc := NewConn(server, router)
+	closed := make(chan CloseInfo, 1)
+	wsc.OnClose(func(c *Conn, info CloseInfo) { closed <- info })
+	go wsc.Serve()
+
+	m, err := NewRequest("GET", "/echo", `"hello"`)
+	require.Nil(t, err)
+	data, _ := json.Marshal(m)
+	require.Nil(t, client.WriteFrame(data))
+
+	frame, err := client.ReadFrame()
+	require.Nil(t, err)
+	res := &Request{}
+	require.Nil(t, json.Unmarshal(frame, res))
+	assert.Equal(t, m.GetUID(), res.GetUID())
+	assert.Equal(t, http.StatusOK, res.GetCode())
+	assert.Equal(t, "pipe", wsc.transportName())
+	assert.Equal(t, "pipe:a", wsc.GetRemoteAddr())
+
+	m, _ = NewRequest("GET", "/bye", nil)
+	data, _ = json.Marshal(m)
+	require.Nil(t, client.WriteFrame(data))
+
+	_, err = client.ReadFrame()
+	cerr, ok := err.(*websocket.CloseError)
+	require.True(t, ok, "expected close error, got %v", err)
+	assert.Equal(t, 4000, cerr.Code)
+	assert.Equal(t, "bye", cerr.Text)
+
+	info := <-closed
+	assert.Equal(t, 4000, info.Code)
+	assert.Equal(t, StateClosed, wsc.State())
+}
+
+func TestPipeClientClose(t *testing.T) {
+	client, server := NewPipe()
+	wsc := NewConn(server, NewRouter())
+	closed := make(chan CloseInfo, 1)
+	wsc.OnClose(func(c *Conn, info CloseInfo) { closed <- info })
+	go wsc.Serve()
+
+	client.Close(websocket.CloseGoingAway, "leaving")
+	info := <-closed
+	assert.Equal(t, websocket.CloseGoingAway, info.Code)
+	assert.Equal(t, "leaving", info.Reason)
+	assert.Nil(t, info.Err)
+	assert.NotNil(t, client.WriteFrame([]byte("{}")))
+}
+
+func TestHTTPTransport(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/item", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("created"), http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/item", nil)
+	wsc := NewConn(NewHTTPTransport(w, r), router)
+	assert.Equal(t, r, wsc.R)
+	wsc.Serve()
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, StateClosed, wsc.State())
+	assert.Equal(t, "rest", wsc.transportName())
+}
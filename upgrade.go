@@ -0,0 +1,89 @@
+package wsrest
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// UpgradeOptions configures websocket upgrade per Handler.
+type UpgradeOptions struct {
+	// AllowedOrigins is list of allowed origins like "https://example.com" or "https://*.example.com".
+	// Scheme can be omitted to allow any. Port is compared only if pattern has one, like "https://example.com:8443".
+	// "*" allows all origins.
+	// Empty list allows only same origin requests or requests without Origin header
+	AllowedOrigins    []string
+	ReadBufferSize    int
+	WriteBufferSize   int
+	EnableCompression bool
+	Subprotocols      []string
+	// Header is added to upgrade response
+	Header http.Header
+}
+
+func (o *UpgradeOptions) upgrader() *websocket.Upgrader {
+	u := &websocket.Upgrader{
+		ReadBufferSize:    o.ReadBufferSize,
+		WriteBufferSize:   o.WriteBufferSize,
+		EnableCompression: o.EnableCompression,
+		Subprotocols:      o.Subprotocols,
+	}
+
+	if len(o.AllowedOrigins) > 0 {
+		origins := append([]string{}, o.AllowedOrigins...)
+		u.CheckOrigin = func(r *http.Request) bool {
+			return checkOrigin(r, origins)
+		}
+	}
+	return u
+}
+
+func checkOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	for _, a := range allowed {
+		if matchOrigin(u, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOrigin(u *url.URL, pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		if !strings.EqualFold(pattern[:i], u.Scheme) {
+			return false
+		}
+		pattern = pattern[i+3:]
+	}
+
+	//Without port in pattern, any port is allowed
+	host := u.Hostname()
+	if _, _, err := net.SplitHostPort(pattern); err == nil {
+		host = u.Host
+	} else {
+		pattern = strings.Trim(pattern, "[]")
+	}
+	host = strings.ToLower(host)
+	pattern = strings.ToLower(pattern)
+	if strings.HasPrefix(pattern, "*.") {
+		//Wildcard matches only subdomains, not domain itself
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
@@ -0,0 +1,85 @@
+package wsrest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	allowed := []string{"https://example.com", "https://*.example.com", "internal.local", "https://*.ports.io:8443", "http://[::1]"}
+
+	testcases := map[string]bool{
+		"":                              true,
+		"https://example.com":           true,
+		"http://example.com":            false,
+		"https://api.example.com":       true,
+		"https://a.b.example.com":       true,
+		"https://badexample.com":        false,
+		"http://internal.local":         true,
+		"https://internal.local":        true,
+		"https://internal.local.io":     false,
+		"https://example.com:8443":      true,
+		"https://api.example.com:443":   true,
+		"http://internal.local:3000":    true,
+		"https://a.ports.io:8443":       true,
+		"https://a.ports.io":            false,
+		"https://a.ports.io:9443":       false,
+		"http://[::1]:8080":             true,
+		"https://example.com.evil:8443": false,
+	}
+
+	for origin, expected := range testcases {
+		r := httptest.NewRequest("GET", "/", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		assert.Equal(t, expected, checkOrigin(r, allowed), origin)
+	}
+}
+
+func TestHandlerUpgradeOptions(t *testing.T) {
+	router := NewRouter()
+
+	public := NewHandler(router)
+	public.Upgrade = UpgradeOptions{
+		AllowedOrigins: []string{"*"},
+		Subprotocols:   []string{"wsrest.v1"},
+		Header:         http.Header{"X-Endpoint": []string{"public"}},
+	}
+
+	internal := NewHandler(router)
+	internal.Upgrade = UpgradeOptions{
+		AllowedOrigins: []string{"https://*.internal.local"},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/public", public)
+	mux.Handle("/internal", internal)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	domain := strings.Replace(server.URL, "http", "ws", 1)
+
+	dialer := &websocket.Dialer{Subprotocols: []string{"wsrest.v1"}}
+	header := http.Header{"Origin": []string{"https://evil.com"}}
+
+	conn, resp, err := dialer.Dial(domain+"/public", header)
+	require.Nil(t, err)
+	assert.Equal(t, "public", resp.Header.Get("X-Endpoint"))
+	assert.Equal(t, "wsrest.v1", conn.Subprotocol())
+	conn.Close()
+
+	_, resp, err = dialer.Dial(domain+"/internal", header)
+	require.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	header.Set("Origin", "https://admin.internal.local")
+	conn, _, err = dialer.Dial(domain+"/internal", header)
+	require.Nil(t, err)
+	conn.Close()
+}
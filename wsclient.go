@@ -1,128 +1,312 @@
 package wsrest
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 	"wsrest/datastream"
+	"wsrest/logger"
+	"wsrest/tracing"
 
 	"github.com/gorilla/websocket"
-	"github.com/sirupsen/logrus"
 )
 
+// ErrNoConnection is returned when request is sent while client is not connected
+var ErrNoConnection = errors.New("No available connection")
+
 type ReadHandler func([]byte)
 type ServerCloseHandler func(err error)
 
 type Client struct {
 	mutex          sync.RWMutex
-	conn           *websocket.Conn
+	conn           Transport
 	callbacks      map[string]chan *Request
 	RequestTimeout time.Duration
-	log            logrus.StdLogger
+	log            logger.Logger
 	fnServerClose  ServerCloseHandler
 	closed         chan struct{}
 	Marshaler      datastream.Marshaler
+	Unmarshaler    datastream.Unmarshaler
 	MessageType    int
+	header         http.Header
+	dialer         websocket.Dialer
+	baseDialer     *websocket.Dialer
+	dialerOpts     []func(d *websocket.Dialer)
+	netDial        NetDialFn
+	subprotocol    string
+	httpFallback   bool
+	interceptors   []Interceptor
+	inflight       chan struct{} //In-flight slots, nil is unlimited
+	inflightPolicy InFlightPolicy
+	stats          clientStats
+	session        string
+	resumed        bool
+	received       uint64 //Frames received in session
+	eventHandler   ReadHandler
+	subscriptions  map[string]*Subscription
+	redial         func() (Transport, error)
+	reconnect      *ReconnectOptions
+	state          ClientState
+	onState        ClientStateHandlerFn
+	reconnected    chan struct{} //Closed once reconnect attempt finishes
+	done           chan struct{} //Closed by Close
+}
+
+// DialOption configures Client on Dial
+type DialOption func(c *Client)
+
+// WithLogger sets client logger. Default is logrus standard logger
+func WithLogger(l logger.Logger) DialOption {
+	return func(c *Client) {
+		c.log = l
+	}
 }
 
-func Dial(wsurl string, eventHandler ReadHandler) (*Client, error) {
+// WithSession resumes server session. received is number of frames received in session, see Client.Session
+func WithSession(id string, received uint64) DialOption {
+	return func(c *Client) {
+		c.session = id
+		c.received = received
+	}
+}
+
+// Dial connects to websocket server
+func Dial(wsurl string, eventHandler ReadHandler, opts ...DialOption) (*Client, error) {
+	c := newClient(opts)
+	c.log = c.log.WithFields(logger.Fields{"url": wsurl})
+	c.redial = func() (Transport, error) {
+		return c.connect(wsurl)
+	}
+
+	var t Transport
+	t, err := c.redial()
+	if err != nil && c.httpFallback && fallbackable(err) {
+		c.log.Warnf("Websocket dial failed, falling back to HTTP err=%s", err)
+		t, err = c.httpTransport(wsurl)
+	}
+	if err != nil {
+		return c, err
+	}
+
+	c.start(t, eventHandler)
+	return c, nil
+}
+
+// DialNet connects to server started with Handler.Serve. Network is "tcp" or "unix"
+func DialNet(network string, addr string, eventHandler ReadHandler, opts ...DialOption) (*Client, error) {
+	c := newClient(opts)
+	c.log = c.log.WithFields(logger.Fields{"addr": addr, "network": network})
+	c.redial = func() (Transport, error) {
+		conn, err := c.dialNet(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return newNetClientTransport(conn), nil
+	}
+
+	t, err := c.redial()
+	if err != nil {
+		return c, err
+	}
+
+	c.start(t, eventHandler)
+	return c, nil
+}
+
+// NewClient creates client on connected transport, for example one end of NewPipe
+func NewClient(t Transport, eventHandler ReadHandler, opts ...DialOption) *Client {
+	c := newClient(opts)
+	c.start(t, eventHandler)
+	return c
+}
+
+func newClient(opts []DialOption) *Client {
 	c := &Client{
 		conn:           nil,
 		RequestTimeout: time.Second * 10,
 		callbacks:      make(map[string]chan *Request),
-		log:            logrus.New(),
+		header:         http.Header{},
+		dialer:         *websocket.DefaultDialer,
+		log:            logger.Default(),
 		Marshaler:      &datastream.JSONMarshaler{},
+		Unmarshaler:    &datastream.JSONMarshaler{},
 		MessageType:    websocket.TextMessage,
+		done:           make(chan struct{}),
 	}
 
-	return c, c.connect(wsurl, eventHandler)
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.buildDialer()
+	return c
 }
 
-func (c *Client) SetLog(l logrus.StdLogger) {
+func (c *Client) SetLog(l logger.Logger) {
 	c.log = l
 }
 
-func (c *Client) connect(wsurl string, eventHandler ReadHandler) error {
+// Session returns server session id and number of frames received in it. Use them with WithSession to resume session
+func (c *Client) Session() (id string, received uint64) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.session, atomic.LoadUint64(&c.received)
+}
+
+// Resumed reports if server resumed session given with WithSession
+func (c *Client) Resumed() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.resumed
+}
+
+// connect dials websocket server, resuming session if there is one
+func (c *Client) connect(wsurl string) (Transport, error) {
 	u, err := url.Parse(wsurl)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	header := c.header.Clone()
+	c.mutex.RLock()
+	if c.session != "" {
+		header.Set(SessionHeader, c.session)
+		header.Set(SessionAckHeader, strconv.FormatUint(atomic.LoadUint64(&c.received), 10))
+	}
+	c.mutex.RUnlock()
+
+	conn, resp, err := c.dialer.Dial(u.String(), header)
 	if err != nil {
-		return err
+		return nil, &DialError{Err: err, Response: resp}
 	}
 
-	c.conn = conn
-	c.closed = make(chan struct{})
+	c.mutex.Lock()
+	if id := resp.Header.Get(SessionHeader); id != "" {
+		c.resumed = resp.Header.Get(SessionResumedHeader) == "true"
+		if !c.resumed {
+			atomic.StoreUint64(&c.received, 0)
+		}
+		c.session = id
+	}
+	c.subprotocol = conn.Subprotocol()
+	c.mutex.Unlock()
+
+	return newWSClientTransport(conn), nil
+}
 
+// start starts reading on connected transport. Transport is closed if client is already closed
+func (c *Client) start(t Transport, eventHandler ReadHandler) bool {
 	if eventHandler == nil {
 		eventHandler = func(d []byte) { return }
 	}
 
-	go c.readMessage(eventHandler)
-	return nil
-	// defer conn.Close()
+	closed := make(chan struct{})
+	c.mutex.Lock()
+	select {
+	case <-c.done:
+		c.mutex.Unlock()
+		t.Close(websocket.CloseNormalClosure, "")
+		return false
+	default:
+	}
+	c.conn = t
+	c.closed = closed
+	c.eventHandler = eventHandler
+	c.mutex.Unlock()
+	c.setState(ClientConnected)
+
+	go c.readMessage(t, eventHandler, closed)
+	return true
 }
 
 func (c *Client) Close() {
 	//Because we are closing connection prevent calling server close error
 	c.mutex.Lock()
 	c.fnServerClose = nil
+	conn := c.conn
+	c.conn = nil
+	closed := c.closed
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	c.mutex.Unlock()
+	c.setState(ClientClosed)
 
-	err := c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-	if err != nil {
-		c.log.Printf("write close: %s\n0", err)
+	if conn == nil {
 		return
 	}
-	c.mutex.Unlock()
 
-	c.log.Println("Closing connection")
+	c.log.Debugf("Closing connection")
+	if err := conn.Close(websocket.CloseNormalClosure, ""); err != nil {
+		c.log.Warnf("close: %s", err)
+	}
+
 	select {
-	case <-c.closed:
+	case <-closed:
 	case <-time.After(time.Second):
 	}
-
-	c.mutex.Lock()
-	c.conn.Close()
-	c.conn = nil
-	c.mutex.Unlock()
 }
 
 func (c *Client) SetServerCloseHandler(fn ServerCloseHandler) {
 	c.fnServerClose = fn
 }
 
-func (c *Client) readMessage(readh ReadHandler) {
+func (c *Client) readMessage(t Transport, readh ReadHandler, closed chan struct{}) {
 	var closeErr error
 	defer func() {
-		close(c.closed)
-		if closeErr != nil {
-			if !websocket.IsCloseError(closeErr, websocket.CloseNormalClosure) {
-				c.log.Printf("Reading stopped. err=%s\n", closeErr)
-			}
+		close(closed)
+		if closeErr == nil {
+			return
+		}
 
-			c.mutex.RLock()
-			fnServerClose := c.fnServerClose
-			c.mutex.RUnlock()
-			if fnServerClose != nil {
-				//Only call if is Server close
-				fnServerClose(closeErr)
-			}
+		c.mutex.Lock()
+		fnServerClose := c.fnServerClose
+		local := c.conn != t
+		reconnect := !local && c.reconnect != nil && c.redial != nil
+		if !local {
+			c.conn = nil
+		}
+		if reconnect {
+			c.reconnected = make(chan struct{})
+		}
+		c.mutex.Unlock()
+
+		//Pending requests can not be responded on lost connection
+		c.failRequestCallbacks()
+
+		if !local && !websocket.IsCloseError(closeErr, websocket.CloseNormalClosure) {
+			c.log.Warnf("Reading stopped. err=%s", closeErr)
+		}
+		if fnServerClose != nil {
+			//Only call if is Server close
+			fnServerClose(closeErr)
+		}
+
+		if reconnect {
+			go c.reconnectLoop()
+		} else if !local {
+			c.setState(ClientClosed)
 		}
 	}()
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		message, err := t.ReadFrame()
 		if err != nil {
 			closeErr = err
 			return
 		}
+		atomic.AddUint64(&c.received, 1)
 
 		if len(message) == 0 {
-			c.log.Println("received empty message")
+			c.log.Debugf("received empty message")
 			continue
 		}
 
@@ -130,29 +314,46 @@ func (c *Client) readMessage(readh ReadHandler) {
 		err = json.Unmarshal(message, m)
 
 		if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
-			c.log.Printf("UnmarshalTypeError err=%s\n", err)
+			c.log.Warnf("UnmarshalTypeError err=%s", err)
 			continue
 		}
 
 		if err == nil {
-			if callback, exists := c.getRequestCallback(m.GetUID()); exists {
+			if callback, exists := c.takeRequestCallback(m.GetUID()); exists {
 				callback <- m
-				c.removeRequestCallback(m.GetUID())
 				continue
 			}
 		}
 
+		if c.dispatchSubscription(message) {
+			continue
+		}
+
 		readh(message)
 	}
 }
 
-func (c *Client) getRequestCallback(RequestId string) (chan *Request, bool) {
-	c.mutex.RLock()
+// takeRequestCallback removes callback, so only one response or failure is delivered to it
+func (c *Client) takeRequestCallback(RequestId string) (chan *Request, bool) {
+	c.mutex.Lock()
 	callback, exists := c.callbacks[RequestId]
-	c.mutex.RUnlock()
+	delete(c.callbacks, RequestId)
+	c.mutex.Unlock()
 	return callback, exists
 }
 
+// failRequestCallbacks closes callbacks of all pending requests
+func (c *Client) failRequestCallbacks() {
+	c.mutex.Lock()
+	callbacks := c.callbacks
+	c.callbacks = make(map[string]chan *Request)
+	c.mutex.Unlock()
+
+	for _, callback := range callbacks {
+		close(callback)
+	}
+}
+
 func (c *Client) addRequestCallback(RequestId string, syncer chan *Request) {
 	c.mutex.Lock()
 	c.callbacks[RequestId] = syncer
@@ -178,38 +379,118 @@ func (c *Client) exec(cr *Request) error {
 	defer c.mutex.Unlock()
 
 	if c.conn == nil {
-		return fmt.Errorf("No available websocket connection")
+		return ErrNoConnection
 	}
 
-	err = c.conn.WriteMessage(c.MessageType, data)
-	return err
+	if ws, ok := c.conn.(*WSTransport); ok {
+		ws.MessageType = c.MessageType
+	}
+	if err := c.conn.WriteFrame(data); err != nil {
+		return fmt.Errorf("%w: %s", ErrConnectionLost, err)
+	}
+	return nil
 }
 
+// Do sends request and waits for response, at most RequestTimeout. Trace context of request context is propagated in envelope
 func (c *Client) Do(m *Request) (*Request, error) {
-	syncer := make(chan *Request)
-	c.addRequestCallback(m.GetUID(), syncer)
+	return c.DoContext(m.Context(), m)
+}
+
+// DoContext sends request and waits for response until context is done.
+// If context has no deadline, RequestTimeout is applied
+func (c *Client) DoContext(ctx context.Context, m *Request) (*Request, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.RequestTimeout)
+		defer cancel()
+	}
+
+	return chain(c.interceptors, c.invoke)(ctx, m)
+}
 
-	err := c.exec(m)
+// invoke sends request within in-flight limit. It is last invoker in interceptor chain
+func (c *Client) invoke(ctx context.Context, m *Request) (*Request, error) {
+	release, err := c.acquire(ctx)
 	if err != nil {
-		c.removeRequestCallback(m.GetUID())
+		c.observe(err)
 		return nil, err
 	}
+	defer release()
 
-	select {
-	case res := <-syncer:
-		return res, nil
-	case <-time.After(c.RequestTimeout):
-		c.removeRequestCallback(m.GetUID())
-		return nil, fmt.Errorf("Timeout occured")
+	atomic.AddInt64(&c.stats.inflight, 1)
+	res, err := c.roundTrip(ctx, m)
+	atomic.AddInt64(&c.stats.inflight, -1)
+	c.observe(err)
+	return res, err
+}
+
+// roundTrip sends request and waits response
+func (c *Client) roundTrip(ctx context.Context, m *Request) (*Request, error) {
+	if m.TraceParent == "" {
+		sctx, span := tracing.Start(ctx, m.GetMethod()+" "+m.GetPath(), tracing.SpanKindClient)
+		defer span.End()
+		span.SetAttribute("wsrest.uid", m.GetUID())
+		m.TraceParent = tracing.TraceParent(sctx)
 	}
+
+	c.mutex.RLock()
+	rt, ok := c.conn.(roundTripper)
+	c.mutex.RUnlock()
+	if ok {
+		res, err := rt.RoundTrip(ctx, m)
+		if err != nil && ctx.Err() != nil {
+			return nil, contextError(ctx)
+		}
+		return res, err
+	}
+
+	for {
+		syncer := make(chan *Request, 1)
+		c.addRequestCallback(m.GetUID(), syncer)
+
+		err := c.exec(m)
+		if err != nil {
+			c.removeRequestCallback(m.GetUID())
+			if c.retryPending() && c.waitReconnect(ctx.Done()) {
+				continue
+			}
+			return nil, err
+		}
+
+		select {
+		case res, ok := <-syncer:
+			if ok {
+				return res, nil
+			}
+			if c.retryPending() && c.waitReconnect(ctx.Done()) {
+				continue
+			}
+			return nil, ErrConnectionLost
+		case <-ctx.Done():
+			c.removeRequestCallback(m.GetUID())
+			return nil, contextError(ctx)
+		}
+	}
+}
+
+// contextError returns error of done request context
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Timeout occured: %w", ctx.Err())
+	}
+	return ctx.Err()
 }
 
 func (c *Client) Execute(method string, resource string, data interface{}) (*Request, error) {
+	return c.ExecuteContext(context.Background(), method, resource, data)
+}
+
+func (c *Client) ExecuteContext(ctx context.Context, method string, resource string, data interface{}) (*Request, error) {
 	m, err := NewRequest(method, resource, data)
 	if err != nil {
 		return nil, err
 	}
-	return c.Do(m)
+	return c.DoContext(ctx, m)
 }
 
 func (c *Client) Get(resource string, data interface{}) (*Request, error) {
@@ -227,3 +508,19 @@ func (c *Client) Put(resource string, data interface{}) (*Request, error) {
 func (c *Client) Delete(resource string, data interface{}) (*Request, error) {
 	return c.Execute("DELETE", resource, data)
 }
+
+func (c *Client) GetContext(ctx context.Context, resource string, data interface{}) (*Request, error) {
+	return c.ExecuteContext(ctx, "GET", resource, data)
+}
+
+func (c *Client) PostContext(ctx context.Context, resource string, data interface{}) (*Request, error) {
+	return c.ExecuteContext(ctx, "POST", resource, data)
+}
+
+func (c *Client) PutContext(ctx context.Context, resource string, data interface{}) (*Request, error) {
+	return c.ExecuteContext(ctx, "PUT", resource, data)
+}
+
+func (c *Client) DeleteContext(ctx context.Context, resource string, data interface{}) (*Request, error) {
+	return c.ExecuteContext(ctx, "DELETE", resource, data)
+}
@@ -0,0 +1,291 @@
+package wsrest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wsrest/datastream"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipeClient serves router on pipe and returns client connected to it
+func pipeClient(t *testing.T, router Router, opts ...DialOption) *Client {
+	client, server := NewPipe()
+	wsc := NewConn(server, router)
+	go wsc.Serve()
+
+	c := NewClient(client, nil, opts...)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *Client) pending() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.callbacks)
+}
+
+func TestClientContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	router := NewRouter()
+	router.HandleFunc("/slow", func(c *Conn, m *Request) {
+		<-release
+		c.Respond(m, SimpleMsg("late"), http.StatusOK)
+	})
+	router.HandleFunc("/fast", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	})
+	c := pipeClient(t, router)
+
+	t.Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := c.GetContext(ctx, "/slow", nil)
+		require.NotNil(t, err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(t, 0, c.pending())
+		assert.Equal(t, 10*time.Second, c.RequestTimeout)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err := c.PostContext(ctx, "/slow", nil)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 0, c.pending())
+	})
+
+	t.Run("RequestTimeout", func(t *testing.T) {
+		c.RequestTimeout = 50 * time.Millisecond
+		defer func() { c.RequestTimeout = 10 * time.Second }()
+
+		_, err := c.Get("/slow", nil)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("Response", func(t *testing.T) {
+		res, err := c.DeleteContext(context.Background(), "/fast", nil)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.GetCode())
+		assert.Equal(t, 0, c.pending())
+	})
+}
+
+func TestDialOptions(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("/ping", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg("pong"), http.StatusOK)
+	})
+	h := NewHandler(router)
+	h.Upgrade.Subprotocols = []string{"wsrest.v2"}
+	h.Authenticator = AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			return nil, ErrUnauthorized
+		}
+		return &Principal{ID: "svc"}, nil
+	})
+
+	server := httptest.NewTLSServer(h)
+	defer server.Close()
+	domain := strings.Replace(server.URL, "https", "wss", 1)
+	tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	t.Run("HeaderTLSSubprotocol", func(t *testing.T) {
+		var dials int32
+		c, err := Dial(domain, nil,
+			WithTLSConfig(tlsConfig),
+			WithHeader("Authorization", "Bearer secret"),
+			WithSubprotocols("wsrest.v1", "wsrest.v2"),
+			WithNetDial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			}),
+		)
+		require.Nil(t, err)
+		defer c.Close()
+
+		assert.Equal(t, "wsrest.v2", c.Subprotocol())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&dials))
+		res, err := c.Get("/ping", nil)
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.GetCode())
+	})
+
+	t.Run("DialerLast", func(t *testing.T) {
+		//Options given before dialer are applied on it
+		c, err := Dial(domain, nil,
+			WithTLSConfig(tlsConfig),
+			WithHeader("Authorization", "Bearer secret"),
+			WithDialer(&websocket.Dialer{HandshakeTimeout: time.Second}),
+		)
+		require.Nil(t, err)
+		defer c.Close()
+		assert.Equal(t, time.Second, c.dialer.HandshakeTimeout)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		_, err := Dial(domain, nil, WithTLSConfig(tlsConfig))
+		derr, ok := err.(*DialError)
+		require.True(t, ok, "expected dial error, got %v", err)
+		require.NotNil(t, derr.Response)
+		assert.Equal(t, http.StatusUnauthorized, derr.Response.StatusCode)
+		assert.Equal(t, websocket.ErrBadHandshake, errors.Unwrap(err))
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		perr := errors.New("no proxy")
+		_, err := Dial(domain, nil, WithProxy(func(r *http.Request) (*url.URL, error) {
+			return nil, perr
+		}))
+		assert.True(t, errors.Is(err, perr))
+	})
+}
+
+func TestDialHandshakeTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	go func() {
+		//Accept and never respond
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = Dial("ws://"+l.Addr().String(), nil, WithHandshakeTimeout(50*time.Millisecond))
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestClientInto(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	router := NewRouter()
+	router.HandleFunc("/user", func(c *Conn, m *Request) {
+		if m.GetParams()["id"] != "1" {
+			c.Respond(m, SimpleMsg("User not found"), http.StatusNotFound)
+			return
+		}
+		c.Respond(m, user{Name: "john"}, http.StatusOK)
+	}).Method("GET")
+	router.HandleFunc("/users", func(c *Conn, m *Request) {
+		u := user{}
+		json.Unmarshal(m.GetData(), &u)
+		c.Respond(m, u, http.StatusCreated)
+	}).Method("POST")
+	c := pipeClient(t, router)
+	ctx := context.Background()
+
+	u := user{}
+	require.Nil(t, c.GetInto(ctx, "/user?id=1", &u))
+	assert.Equal(t, "john", u.Name)
+
+	created := user{}
+	require.Nil(t, c.PostInto(ctx, "/users", user{Name: "jane"}, &created))
+	assert.Equal(t, "jane", created.Name)
+
+	err := c.GetInto(ctx, "/user?id=2", &u)
+	serr, ok := err.(*StatusError)
+	require.True(t, ok, "expected status error, got %v", err)
+	assert.Equal(t, http.StatusNotFound, serr.Code)
+	assert.Equal(t, "User not found", serr.Message)
+	assert.JSONEq(t, `{"message":"User not found"}`, string(serr.Body))
+	assert.Equal(t, "Request failed with status 404: User not found", err.Error())
+
+	require.Nil(t, c.PostInto(ctx, "/users", user{Name: "jane"}, nil))
+
+	//Error body is decoded with client unmarshaler
+	um := &countingUnmarshaler{}
+	c.Unmarshaler = um
+	err = c.GetInto(ctx, "/user?id=2", &u)
+	serr, ok = err.(*StatusError)
+	require.True(t, ok, "expected status error, got %v", err)
+	assert.Equal(t, "User not found", serr.Message)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&um.calls))
+}
+
+type countingUnmarshaler struct {
+	datastream.JSONMarshaler
+	calls int32
+}
+
+func (u *countingUnmarshaler) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt32(&u.calls, 1)
+	return u.JSONMarshaler.Unmarshal(data, v)
+}
+
+func TestClientInterceptors(t *testing.T) {
+	var calls int32
+	router := NewRouter()
+	router.HandleFunc("/whoami", func(c *Conn, m *Request) {
+		c.Respond(m, SimpleMsg(m.GetHeader("Authorization")), http.StatusOK)
+	})
+	router.HandleFunc("/flaky", func(c *Conn, m *Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			c.Respond(m, SimpleMsg("try again"), http.StatusServiceUnavailable)
+			return
+		}
+		c.Respond(m, SimpleMsg("ok"), http.StatusOK)
+	})
+
+	var order []string
+	auth := func(ctx context.Context, m *Request, next Invoker) (*Request, error) {
+		order = append(order, "auth")
+		m.SetHeader("authorization", "Bearer token")
+		return next(ctx, m)
+	}
+	retry := func(ctx context.Context, m *Request, next Invoker) (*Request, error) {
+		order = append(order, "retry")
+		res, err := next(ctx, m)
+		if err == nil && res.GetCode() == http.StatusServiceUnavailable {
+			return next(ctx, m)
+		}
+		return res, err
+	}
+	c := pipeClient(t, router, WithInterceptors(auth, retry))
+
+	msg := SimpleMessage{}
+	require.Nil(t, c.GetInto(context.Background(), "/whoami", &msg))
+	assert.Equal(t, "Bearer token", msg.Message)
+	assert.Equal(t, []string{"auth", "retry"}, order)
+
+	res, err := c.Get("/flaky", nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.GetCode())
+	assert.Nil(t, res.Header, "request headers must not be echoed")
+
+	t.Run("ShortCircuit", func(t *testing.T) {
+		denied := errors.New("denied")
+		c.Use(func(ctx context.Context, m *Request, next Invoker) (*Request, error) {
+			return nil, denied
+		})
+		_, err := c.Get("/whoami", nil)
+		assert.Equal(t, denied, err)
+		assert.Equal(t, 0, c.pending())
+	})
+}
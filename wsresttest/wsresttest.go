@@ -0,0 +1,158 @@
+// Package wsresttest provides in memory server and client for testing handlers without sockets
+package wsresttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"wsrest"
+)
+
+// Recorder is transport wrapper capturing every frame written to it
+type Recorder struct {
+	wsrest.Transport
+	mutex  sync.Mutex
+	frames [][]byte
+}
+
+func NewRecorder(t wsrest.Transport) *Recorder {
+	return &Recorder{Transport: t}
+}
+
+func (r *Recorder) WriteFrame(data []byte) error {
+	r.mutex.Lock()
+	r.frames = append(r.frames, data)
+	r.mutex.Unlock()
+	return r.Transport.WriteFrame(data)
+}
+
+func (r *Recorder) Name() string {
+	if t, ok := r.Transport.(interface{ Name() string }); ok {
+		return t.Name()
+	}
+	return "recorder"
+}
+
+// Frames returns all recorded frames in written order
+func (r *Recorder) Frames() [][]byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	frames := make([][]byte, len(r.frames))
+	copy(frames, r.frames)
+	return frames
+}
+
+// Responses returns recorded frames which are response envelopes
+func (r *Recorder) Responses() []*wsrest.Request {
+	var responses []*wsrest.Request
+	for _, frame := range r.Frames() {
+		m := &wsrest.Request{}
+		if err := json.Unmarshal(frame, m); err != nil || m.GetUID() == "" || m.GetCode() == 0 {
+			continue
+		}
+		responses = append(responses, m)
+	}
+	return responses
+}
+
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.frames = nil
+}
+
+// Server is router served on connection over in memory pipe, with client on other end
+type Server struct {
+	Conn     *wsrest.Conn
+	Client   *wsrest.Client
+	Recorder *Recorder
+
+	mutex  sync.Mutex
+	events [][]byte
+}
+
+// NewServer starts serving router. Close must be called when done
+func NewServer(router wsrest.Router, opts ...wsrest.DialOption) *Server {
+	client, server := wsrest.NewPipe()
+	s := &Server{Recorder: NewRecorder(server)}
+	s.Conn = wsrest.NewConn(s.Recorder, router)
+	go s.Conn.Serve()
+
+	s.Client = wsrest.NewClient(client, func(data []byte) {
+		s.mutex.Lock()
+		s.events = append(s.events, data)
+		s.mutex.Unlock()
+	}, opts...)
+	return s
+}
+
+// Events returns frames client received that are not responses
+func (s *Server) Events() [][]byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	events := make([][]byte, len(s.events))
+	copy(events, s.events)
+	return events
+}
+
+// Close closes client and waits until connection is closed
+func (s *Server) Close() {
+	s.Client.Close()
+	for i := 0; i < 100 && !s.Conn.IsClosed(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// DoWS sends request over in memory websocket connection and returns response
+func DoWS(t testing.TB, router wsrest.Router, method string, path string, body interface{}) *wsrest.Request {
+	t.Helper()
+	s := NewServer(router)
+	defer s.Close()
+
+	res, err := s.Client.Execute(method, path, body)
+	if err != nil {
+		t.Fatalf("wsresttest: %s %s failed: %s", method, path, err)
+	}
+	return res
+}
+
+// DoREST serves request as HTTP request and returns response. Body is encoded same as in wsrest.NewRequest
+func DoREST(t testing.TB, router wsrest.Router, method string, path string, body interface{}) *wsrest.Request {
+	t.Helper()
+	m, err := wsrest.NewRequest(method, path, body)
+	if err != nil {
+		t.Fatalf("wsresttest: encoding body failed: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, bytes.NewReader(m.GetData()))
+	wsc, err := wsrest.NewConnRest(w, r, router)
+	if err != nil {
+		t.Fatalf("wsresttest: %s", err)
+	}
+	wsc.Serve()
+
+	data := json.RawMessage(w.Body.Bytes())
+	m.SetCode(w.Code)
+	m.Data = &data
+	return m
+}
+
+// Do runs request on both REST and websocket path. Test fails if responses differ.
+// Websocket response is returned
+func Do(t testing.TB, router wsrest.Router, method string, path string, body interface{}) *wsrest.Request {
+	t.Helper()
+	rest := DoREST(t, router, method, path, body)
+	ws := DoWS(t, router, method, path, body)
+
+	if rest.GetCode() != ws.GetCode() {
+		t.Errorf("wsresttest: %s %s code differs rest=%d ws=%d", method, path, rest.GetCode(), ws.GetCode())
+	}
+	if !bytes.Equal(bytes.TrimSpace(rest.GetData()), bytes.TrimSpace(ws.GetData())) {
+		t.Errorf("wsresttest: %s %s data differs rest=%s ws=%s", method, path, rest.GetData(), ws.GetData())
+	}
+	return ws
+}
@@ -0,0 +1,70 @@
+package wsresttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+	"wsrest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	Name string `json:"name"`
+}
+
+func testRouter() *wsrest.FastRouter {
+	router := wsrest.NewRouter()
+	router.HandleFunc("/items", func(c *wsrest.Conn, m *wsrest.Request) {
+		it := item{}
+		if err := json.Unmarshal(m.GetData(), &it); err != nil {
+			c.Respond(m, wsrest.SimpleMsg("Bad item"), http.StatusBadRequest)
+			return
+		}
+		c.Respond(m, it, http.StatusCreated)
+	}).Method("POST")
+	router.HandleFunc("/notify", func(c *wsrest.Conn, m *wsrest.Request) {
+		c.WriteWS([]byte(`{"type":"notified"}`))
+		c.Respond(m, wsrest.SimpleMsg("ok"), http.StatusOK)
+	})
+	return router
+}
+
+func TestDo(t *testing.T) {
+	router := testRouter()
+
+	res := Do(t, router, "POST", "/items", item{Name: "first"})
+	assert.Equal(t, http.StatusCreated, res.GetCode())
+	assert.JSONEq(t, `{"name":"first"}`, string(res.GetData()))
+
+	res = Do(t, router, "POST", "/items", `"bad"`)
+	assert.Equal(t, http.StatusBadRequest, res.GetCode())
+
+	res = DoREST(t, router, "GET", "/missing", nil)
+	assert.Equal(t, http.StatusNotFound, res.GetCode())
+}
+
+func TestServerRecorder(t *testing.T) {
+	s := NewServer(testRouter())
+	defer s.Close()
+
+	res, err := s.Client.Get("/notify", nil)
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.GetCode())
+
+	frames := s.Recorder.Frames()
+	require.Len(t, frames, 2)
+	assert.Equal(t, `{"type":"notified"}`, string(frames[0]))
+
+	responses := s.Recorder.Responses()
+	require.Len(t, responses, 1)
+	assert.Equal(t, res.GetUID(), responses[0].GetUID())
+
+	assert.Eventually(t, func() bool { return len(s.Events()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "pipe", s.Recorder.Name())
+
+	s.Recorder.Reset()
+	assert.Len(t, s.Recorder.Frames(), 0)
+}